@@ -0,0 +1,129 @@
+package main
+
+import (
+	"L0/internal/config"
+	"L0/internal/consistency"
+	"L0/internal/models"
+	"L0/internal/storage/postgres"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type options struct {
+	rules      string
+	tolerance  int64
+	from       string
+	to         string
+	customerID string
+	batchSize  int
+	limit      int
+	report     string
+}
+
+func main() {
+	var opts options
+
+	// Флаги определяются до config.MustLoad, который сам вызывает flag.Parse
+	flag.StringVar(&opts.rules, "rules", "", "comma-separated rules to check, defaults to consistency.rules or all: "+strings.Join(consistency.Rules(), ", "))
+	flag.Int64Var(&opts.tolerance, "tolerance", -1, "allowed difference in currency minor units, defaults to consistency.tolerance_minor")
+	flag.StringVar(&opts.from, "from", "", "check orders created at or after this date (RFC3339 or 2006-01-02)")
+	flag.StringVar(&opts.to, "to", "", "check orders created before this date (RFC3339 or 2006-01-02)")
+	flag.StringVar(&opts.customerID, "customer", "", "check orders of this customer only")
+	flag.IntVar(&opts.batchSize, "batch", 1000, "rows fetched from the cursor at once")
+	flag.IntVar(&opts.limit, "limit", 100, "orders listed per rule in the report, counters are always full")
+	flag.StringVar(&opts.report, "report", "", "write the JSON report to this file")
+
+	cfg := config.MustLoad()
+
+	// Проверка включается флагом consistency.enabled только для приема, здесь она нужна всегда
+	rulesCfg := cfg.Consistency
+	if opts.rules != "" {
+		rulesCfg.Rules = nil
+		for _, name := range strings.Split(opts.rules, ",") {
+			rulesCfg.Rules = append(rulesCfg.Rules, strings.TrimSpace(name))
+		}
+	}
+	if opts.tolerance >= 0 {
+		rulesCfg.ToleranceMinor = opts.tolerance
+	}
+	checker, err := consistency.New(rulesCfg)
+	if err != nil {
+		log.Fatalf("failed to init consistency checker: %v", err)
+	}
+
+	filter, err := buildFilter(opts)
+	if err != nil {
+		log.Fatalf("invalid filter: %v", err)
+	}
+
+	storage, err := postgres.InitDB(cfg)
+	if err != nil {
+		log.Fatalf("failed to init storage: %v", err)
+	}
+	defer func() {
+		if err := storage.Close(); err != nil {
+			log.Printf("failed to close database: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	rep := newReport(checker.Rules(), rulesCfg.ToleranceMinor, opts.limit)
+
+	start := time.Now()
+	err = storage.StreamOrders(ctx, filter, func(order models.Order) error {
+		rep.add(order, checker.Check(order))
+		return nil
+	})
+	rep.Duration = time.Since(start).Round(time.Millisecond).String()
+	if err != nil {
+		log.Printf("check stopped after %d orders: %v", rep.Total, err)
+	}
+
+	rep.print()
+	if opts.report != "" {
+		if err := rep.save(opts.report); err != nil {
+			log.Printf("failed to save report: %v", err)
+		}
+	}
+
+	if err != nil || rep.Inconsistent > 0 {
+		os.Exit(1)
+	}
+}
+
+func buildFilter(opts options) (postgres.StreamFilter, error) {
+	filter := postgres.StreamFilter{
+		CustomerID: opts.customerID,
+		BatchSize:  opts.batchSize,
+	}
+
+	var err error
+	if filter.From, err = parseDate(opts.from); err != nil {
+		return filter, fmt.Errorf("-from: %w", err)
+	}
+	if filter.To, err = parseDate(opts.to); err != nil {
+		return filter, fmt.Errorf("-to: %w", err)
+	}
+
+	return filter, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.DateOnly, s)
+}
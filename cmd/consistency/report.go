@@ -0,0 +1,105 @@
+package main
+
+import (
+	"L0/internal/models"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// violation является заказом, нарушившим правило, со всеми сообщениями по этому правилу
+type violation struct {
+	OrderUID string   `json:"order_uid"`
+	Messages []string `json:"messages"`
+}
+
+// ruleReport собирает нарушения одного правила
+type ruleReport struct {
+	Rule   string      `json:"rule"`
+	Orders int         `json:"orders"`
+	Listed []violation `json:"listed"`
+}
+
+// report накапливает итоги проверки, нарушения сгруппированы по правилам в порядке их проверки
+type report struct {
+	ToleranceMinor int64         `json:"tolerance_minor"`
+	Total          int           `json:"total"`
+	Inconsistent   int           `json:"inconsistent"`
+	Duration       string        `json:"duration"`
+	Rules          []*ruleReport `json:"rules"`
+
+	limit int
+}
+
+// newReport заводит группы всех проверяемых правил, чтобы в отчете были и правила без нарушений
+func newReport(rules []string, tolerance int64, limit int) *report {
+	r := &report{ToleranceMinor: tolerance, Rules: make([]*ruleReport, len(rules)), limit: limit}
+	for i, name := range rules {
+		r.Rules[i] = &ruleReport{Rule: name, Listed: []violation{}}
+	}
+
+	return r
+}
+
+func (r *report) add(order models.Order, warnings []models.Warning) {
+	r.Total++
+	if len(warnings) == 0 {
+		return
+	}
+	r.Inconsistent++
+
+	// Предупреждения одного правила идут подряд, см. consistency.Checker.Check
+	for i := 0; i < len(warnings); {
+		j := i
+		var messages []string
+		for ; j < len(warnings) && warnings[j].Rule == warnings[i].Rule; j++ {
+			messages = append(messages, warnings[j].Message)
+		}
+
+		rule := r.rule(warnings[i].Rule)
+		rule.Orders++
+		if len(rule.Listed) < r.limit {
+			rule.Listed = append(rule.Listed, violation{OrderUID: order.OrderUID, Messages: messages})
+		}
+		i = j
+	}
+}
+
+func (r *report) rule(name string) *ruleReport {
+	for _, rule := range r.Rules {
+		if rule.Rule == name {
+			return rule
+		}
+	}
+
+	// Checker не возвращает правил вне списка, но отчет не должен терять нарушения
+	rule := &ruleReport{Rule: name, Listed: []violation{}}
+	r.Rules = append(r.Rules, rule)
+
+	return rule
+}
+
+func (r *report) print() {
+	fmt.Printf("total=%d inconsistent=%d tolerance_minor=%d duration=%s\n",
+		r.Total, r.Inconsistent, r.ToleranceMinor, r.Duration)
+
+	for _, rule := range r.Rules {
+		fmt.Printf("%s: %d orders\n", rule.Rule, rule.Orders)
+		for _, v := range rule.Listed {
+			fmt.Printf("  %s: %s\n", v.OrderUID, strings.Join(v.Messages, "; "))
+		}
+		if skipped := rule.Orders - len(rule.Listed); skipped > 0 {
+			fmt.Printf("  ... and %d more\n", skipped)
+		}
+	}
+}
+
+func (r *report) save(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o644)
+}
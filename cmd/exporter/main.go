@@ -0,0 +1,247 @@
+package main
+
+import (
+	"L0/internal/config"
+	"L0/internal/lib/orderenc"
+	"L0/internal/models"
+	"L0/internal/storage/postgres"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type options struct {
+	format          string
+	gzip            bool
+	out             string
+	from            string
+	to              string
+	customerID      string
+	after           string
+	stateFile       string
+	batchSize       int
+	checkpointEvery int
+}
+
+func main() {
+	var opts options
+
+	// Флаги определяются до config.MustLoad, который сам вызывает flag.Parse
+	flag.StringVar(&opts.format, "format", orderenc.FormatNDJSON, "output format: ndjson or csv")
+	flag.BoolVar(&opts.gzip, "gzip", false, "gzip-compress the output")
+	flag.StringVar(&opts.out, "out", "-", "output file, - for stdout")
+	flag.StringVar(&opts.from, "from", "", "export orders created at or after this date (RFC3339 or 2006-01-02)")
+	flag.StringVar(&opts.to, "to", "", "export orders created before this date (RFC3339 or 2006-01-02)")
+	flag.StringVar(&opts.customerID, "customer", "", "export orders of this customer only")
+	flag.StringVar(&opts.after, "after", "", "resume after this order_uid")
+	flag.StringVar(&opts.stateFile, "state", "", "file with the last exported order_uid and output offset, used to resume")
+	flag.IntVar(&opts.batchSize, "batch", 1000, "rows fetched from the cursor at once")
+	flag.IntVar(&opts.checkpointEvery, "checkpoint-every", 1000, "save progress every N orders")
+
+	cfg := config.MustLoad()
+
+	if opts.format != orderenc.FormatNDJSON && opts.format != orderenc.FormatCSV {
+		log.Fatalf("unsupported format %q", opts.format)
+	}
+
+	filter, st, err := buildFilter(opts)
+	if err != nil {
+		log.Fatalf("invalid filter: %v", err)
+	}
+
+	storage, err := postgres.InitDB(cfg)
+	if err != nil {
+		log.Fatalf("failed to init storage: %v", err)
+	}
+	defer func() {
+		if err := storage.Close(); err != nil {
+			log.Printf("failed to close database: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	start := time.Now()
+	count, last, err := export(ctx, storage, filter, st, opts)
+	if err != nil {
+		log.Fatalf("export stopped after %d orders (last order_uid %q): %v", count, last, err)
+	}
+
+	log.Printf("exported %d orders in %s, last order_uid %q", count, time.Since(start).Round(time.Millisecond), last)
+}
+
+func buildFilter(opts options) (postgres.StreamFilter, exportState, error) {
+	filter := postgres.StreamFilter{
+		AfterUID:   opts.after,
+		CustomerID: opts.customerID,
+		BatchSize:  opts.batchSize,
+	}
+	st := exportState{Offset: -1}
+
+	if filter.AfterUID == "" && opts.stateFile != "" {
+		var err error
+		if st, err = readState(opts.stateFile); err != nil {
+			return filter, st, err
+		}
+		filter.AfterUID = st.After
+	}
+
+	var err error
+	if filter.From, err = parseDate(opts.from); err != nil {
+		return filter, st, fmt.Errorf("-from: %w", err)
+	}
+	if filter.To, err = parseDate(opts.to); err != nil {
+		return filter, st, fmt.Errorf("-to: %w", err)
+	}
+
+	return filter, st, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	return time.Parse(time.DateOnly, s)
+}
+
+// export пишет заказы в файл, сохраняя прогресс каждые checkpointEvery заказов.
+// При продолжении выгрузки файл обрезается до смещения из состояния: заказы,
+// записанные после последней контрольной точки, выгружаются заново
+func export(ctx context.Context, storage *postgres.Storage, filter postgres.StreamFilter, st exportState, opts options) (int, string, error) {
+	resuming := filter.AfterUID != ""
+	if resuming && st.Offset < 0 && opts.out != "-" {
+		log.Printf("no output offset for order_uid %q, appending to %s as is", filter.AfterUID, opts.out)
+	}
+
+	out, err := openOutput(opts.out, opts.format, opts.gzip, resuming, st.Offset)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			log.Printf("failed to close output: %v", err)
+		}
+	}()
+
+	var (
+		count int
+		last  = filter.AfterUID
+	)
+
+	// save пишет состояние только после того, как данные до offset уже на диске
+	save := func(offset int64) error {
+		if opts.stateFile == "" || last == "" {
+			return nil
+		}
+		return writeState(opts.stateFile, exportState{After: last, Offset: offset})
+	}
+
+	checkpoint := func() error {
+		offset, err := out.checkpoint()
+		if err != nil {
+			return err
+		}
+		return save(offset)
+	}
+
+	err = storage.StreamOrders(ctx, filter, func(order models.Order) error {
+		if err := out.Write(order); err != nil {
+			return err
+		}
+		count++
+		last = order.OrderUID
+
+		if count%opts.checkpointEvery == 0 {
+			return checkpoint()
+		}
+		return nil
+	})
+	if err != nil {
+		if cpErr := checkpoint(); cpErr != nil {
+			log.Printf("failed to save progress: %v", cpErr)
+		}
+		return count, last, err
+	}
+
+	offset, err := out.finish()
+	if err != nil {
+		return count, last, err
+	}
+	if err := save(offset); err != nil {
+		return count, last, err
+	}
+
+	return count, last, nil
+}
+
+// exportState является содержимым файла -state. Offset равен размеру файла выгрузки
+// после заказа After, -1 означает, что смещение неизвестно
+type exportState struct {
+	After  string `json:"after"`
+	Offset int64  `json:"offset"`
+}
+
+// readState читает состояние. Прежний формат с одним order_uid читается без смещения
+func readState(path string) (exportState, error) {
+	st := exportState{Offset: -1}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	b = bytes.TrimSpace(b)
+	if !bytes.HasPrefix(b, []byte("{")) {
+		st.After = string(b)
+		return st, nil
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return st, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	return st, nil
+}
+
+// writeState атомарно заменяет файл состояния через rename. Временный файл
+// синхронизируется до rename, чтобы после сбоя не остаться с пустым состоянием
+func writeState(path string, st exportState) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to sync state file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	return os.Rename(tmp, path)
+}
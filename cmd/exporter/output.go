@@ -0,0 +1,173 @@
+package main
+
+import (
+	"L0/internal/lib/orderenc"
+	"L0/internal/models"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+)
+
+// output пишет выгрузку и считает байты файла. checkpoint сбрасывает данные на диск
+// и возвращает смещение, до которого файл целый: при продолжении выгрузки все,
+// что записано после него, отрезается
+type output struct {
+	file *os.File
+	// seekable ложно для stdout: его нельзя обрезать и синхронизировать
+	seekable bool
+	counter  *countingWriter
+	gz       *gzip.Writer
+	ow       orderenc.Writer
+}
+
+// openOutput открывает файл выгрузки. offset >= 0 продолжает выгрузку с этого смещения,
+// отрезая хвост после него, offset < 0 с resuming дописывает файл как есть,
+// без resuming файл перезаписывается
+func openOutput(path, format string, gz bool, resuming bool, offset int64) (*output, error) {
+	o := &output{file: os.Stdout}
+
+	if path != "-" {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if resuming {
+			flags = os.O_CREATE | os.O_WRONLY
+		}
+		f, err := os.OpenFile(path, flags, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		o.file, o.seekable = f, true
+
+		if err := o.seek(resuming, offset); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+
+	pos, err := o.position()
+	if err != nil {
+		_ = o.Close()
+		return nil, err
+	}
+	o.counter = &countingWriter{w: o.file, n: pos}
+
+	var w io.Writer = o.counter
+	if gz {
+		// Каждая контрольная точка закрывает член gzip, так что файл до нее
+		// читается gunzip и zcat как multi-member gzip
+		o.gz = gzip.NewWriter(w)
+		w = o.gz
+	}
+
+	var encOpts []orderenc.Option
+	if resuming && pos > 0 {
+		encOpts = append(encOpts, orderenc.SkipCSVHeader())
+	}
+
+	if o.ow, err = orderenc.NewWriter(format, w, encOpts...); err != nil {
+		_ = o.Close()
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// seek ставит позицию записи: в конец файла или на сохраненное смещение
+func (o *output) seek(resuming bool, offset int64) error {
+	if !resuming {
+		return nil
+	}
+	if offset < 0 {
+		_, err := o.file.Seek(0, io.SeekEnd)
+		return err
+	}
+
+	info, err := o.file.Stat()
+	if err != nil {
+		return err
+	}
+	// Файл короче сохраненного смещения не от этой выгрузки
+	if info.Size() < offset {
+		return fmt.Errorf("output %s has %d bytes, state expects at least %d", o.file.Name(), info.Size(), offset)
+	}
+	if err := o.file.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate output to %d bytes: %w", offset, err)
+	}
+	_, err = o.file.Seek(offset, io.SeekStart)
+
+	return err
+}
+
+func (o *output) position() (int64, error) {
+	if !o.seekable {
+		return 0, nil
+	}
+
+	return o.file.Seek(0, io.SeekCurrent)
+}
+
+func (o *output) Write(order models.Order) error {
+	return o.ow.Write(order)
+}
+
+// checkpoint дописывает начатый член gzip и синхронизирует файл. Возвращенное смещение
+// можно сохранять в состояние только после успешного checkpoint: данные идут на диск первыми
+func (o *output) checkpoint() (int64, error) {
+	if err := o.ow.Flush(); err != nil {
+		return 0, err
+	}
+	if o.gz != nil {
+		if err := o.gz.Close(); err != nil {
+			return 0, err
+		}
+		o.gz.Reset(o.counter)
+	}
+	if o.seekable {
+		if err := o.file.Sync(); err != nil {
+			return 0, fmt.Errorf("failed to sync output: %w", err)
+		}
+	}
+
+	return o.counter.n, nil
+}
+
+// finish дописывает хвост формата и последний член gzip, синхронизирует файл
+// и возвращает его итоговый размер
+func (o *output) finish() (int64, error) {
+	if err := o.ow.Close(); err != nil {
+		return 0, err
+	}
+	if o.gz != nil {
+		if err := o.gz.Close(); err != nil {
+			return 0, err
+		}
+	}
+	if o.seekable {
+		if err := o.file.Sync(); err != nil {
+			return 0, fmt.Errorf("failed to sync output: %w", err)
+		}
+	}
+
+	return o.counter.n, nil
+}
+
+func (o *output) Close() error {
+	if !o.seekable {
+		return nil
+	}
+
+	return o.file.Close()
+}
+
+// countingWriter считает смещение в файле после записанных байт
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"L0/internal/config"
+	"L0/internal/consistency"
+	"L0/internal/kafka/headers"
+	"L0/internal/kafka/producer"
+	"L0/internal/lib/audit"
+	"L0/internal/lib/orderenc"
+	"L0/internal/lib/strictjson"
+	"L0/internal/models"
+	"L0/internal/service"
+	"L0/internal/storage/postgres"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	modeStorage = "storage"
+	modeKafka   = "kafka"
+
+	// sourceSystem помечает заказы, загруженные импортером
+	sourceSystem = "order-importer"
+
+	// maxFailures ограничивает число ошибок в отчете, счетчики считаются всегда
+	maxFailures = 1000
+)
+
+type options struct {
+	mode      string
+	batchSize int
+	rate      float64
+	dryRun    bool
+	report    string
+}
+
+// sink принимает пачку заказов и возвращает ошибку по каждому
+type sink interface {
+	Write(ctx context.Context, orders []models.Order) []error
+	Close() error
+}
+
+func main() {
+	var opts options
+
+	// Флаги определяются до config.MustLoad, который сам вызывает flag.Parse
+	flag.StringVar(&opts.mode, "mode", modeStorage, "where to import: storage or kafka")
+	flag.IntVar(&opts.batchSize, "batch", 500, "orders written at once")
+	flag.Float64Var(&opts.rate, "rate", 0, "max orders per second, 0 for unlimited")
+	flag.BoolVar(&opts.dryRun, "dry-run", false, "decode and validate only, write nothing")
+	flag.StringVar(&opts.report, "report", "", "write the JSON summary report to this file")
+
+	cfg := config.MustLoad()
+
+	files := flag.Args()
+	if len(files) == 0 {
+		log.Fatal("usage: importer [flags] file.ndjson [file.json ...], - for stdin")
+	}
+	if opts.batchSize <= 0 {
+		log.Fatal("-batch must be positive")
+	}
+
+	var out sink
+	if !opts.dryRun {
+		var err error
+		out, err = newSink(cfg, opts.mode)
+		if err != nil {
+			log.Fatalf("failed to init %s sink: %v", opts.mode, err)
+		}
+		defer func() {
+			if err := out.Close(); err != nil {
+				log.Printf("failed to close %s sink: %v", opts.mode, err)
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Один trace на запуск импорта, чтобы по нему находить все загруженные заказы
+	traceID := headers.NewTraceID()
+	log.Printf("trace id %s", traceID)
+	ctx = audit.WithInfo(ctx, audit.Info{TraceID: traceID, SourceSystem: sourceSystem})
+
+	imp := &importer{
+		sink:      out,
+		batchSize: opts.batchSize,
+		decoding:  cfg.Kafka.Decoding,
+		report:    &report{Mode: opts.mode, DryRun: opts.dryRun},
+	}
+	if opts.rate > 0 {
+		imp.limiter = rate.NewLimiter(rate.Limit(opts.rate), opts.batchSize)
+	}
+	// В режиме kafka предупреждения расставит консюмер при сохранении
+	if cfg.Consistency.Enabled && opts.mode == modeStorage {
+		checker, err := consistency.New(cfg.Consistency)
+		if err != nil {
+			log.Fatalf("failed to init consistency checker: %v", err)
+		}
+		imp.checker = checker
+	}
+
+	start := time.Now()
+	for _, file := range files {
+		if err := imp.importFile(ctx, file); err != nil {
+			log.Printf("failed to import %s: %v", file, err)
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	imp.report.Duration = time.Since(start).Round(time.Millisecond).String()
+
+	imp.report.print()
+	if opts.report != "" {
+		if err := imp.report.save(opts.report); err != nil {
+			log.Printf("failed to save report: %v", err)
+		}
+	}
+
+	if imp.report.Invalid > 0 || imp.report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func newSink(cfg *config.Config, mode string) (sink, error) {
+	switch mode {
+	case modeStorage:
+		storage, err := postgres.InitDB(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &storageSink{storage: storage}, nil
+	case modeKafka:
+		// Отчет импортера строится по результату записи, поэтому публикация всегда синхронная
+		kcfg := cfg.Kafka
+		kcfg.Producer.Async = false
+		pub, err := producer.New(kcfg, sourceSystem, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &kafkaSink{producer: pub}, nil
+	default:
+		return nil, fmt.Errorf("unknown mode %q", mode)
+	}
+}
+
+type importer struct {
+	sink      sink
+	limiter   *rate.Limiter
+	batchSize int
+	report    *report
+	// checker помечает заказы предупреждениями при записи прямо в БД, минуя OrderService
+	checker *consistency.Checker
+	// decoding задает разбор заказов, как у консюмера: kafka.decoding
+	decoding config.Decoding
+
+	batch []pending
+}
+
+// pending хранит заказ до записи вместе с его положением во входном файле
+type pending struct {
+	file  string
+	index int
+	order models.Order
+}
+
+func (imp *importer) importFile(ctx context.Context, path string) error {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				log.Printf("failed to close %s: %v", path, err)
+			}
+		}()
+		r = f
+	}
+
+	dec := orderenc.NewDecoder(r)
+	for i := 0; ; i++ {
+		raw, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			imp.flush(ctx)
+			return fmt.Errorf("at byte %d: %w", dec.InputOffset(), err)
+		}
+
+		imp.report.Total++
+
+		if int64(len(raw)) > imp.decoding.MaxBytes {
+			imp.report.fail(path, i, "", statusInvalid, fmt.Sprintf("order is larger than %d bytes", imp.decoding.MaxBytes))
+			continue
+		}
+
+		var order models.Order
+		problems, err := strictjson.Unmarshal(raw, &order, imp.decoding.Mode)
+		if err != nil {
+			var jsonErr *strictjson.Error
+			if errors.As(err, &jsonErr) {
+				imp.report.fail(path, i, "", statusInvalid, jsonErr.Problems...)
+			} else {
+				imp.report.fail(path, i, "", statusInvalid, err.Error())
+			}
+			continue
+		}
+		if len(problems) > 0 {
+			log.Printf("%s[%d]: accepted order %s with unexpected JSON: %s", path, i, order.OrderUID, strings.Join(problems, "; "))
+		}
+
+		// Те же правила, что у OrderService.SaveOrder: нормализация, валидация и сверка сумм
+		if err := service.Prepare(&order, imp.checker); err != nil {
+			var validationErr *models.ValidationError
+			if errors.As(err, &validationErr) {
+				imp.report.fail(path, i, order.OrderUID, statusInvalid, validationErr.Reasons...)
+			} else {
+				imp.report.fail(path, i, order.OrderUID, statusInvalid, err.Error())
+			}
+			continue
+		}
+
+		if imp.sink == nil {
+			imp.report.Imported++
+			continue
+		}
+
+		imp.batch = append(imp.batch, pending{file: path, index: i, order: order})
+		if len(imp.batch) >= imp.batchSize {
+			if err := imp.flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	return imp.flush(ctx)
+}
+
+// flush пишет накопленную пачку с учетом ограничения скорости
+func (imp *importer) flush(ctx context.Context) error {
+	if len(imp.batch) == 0 {
+		return nil
+	}
+	defer func() { imp.batch = imp.batch[:0] }()
+
+	if imp.limiter != nil {
+		if err := imp.limiter.WaitN(ctx, len(imp.batch)); err != nil {
+			for _, p := range imp.batch {
+				imp.report.fail(p.file, p.index, p.order.OrderUID, statusFailed, err.Error())
+			}
+			return err
+		}
+	}
+
+	orders := make([]models.Order, len(imp.batch))
+	for i, p := range imp.batch {
+		orders[i] = p.order
+	}
+
+	errs := imp.sink.Write(ctx, orders)
+	for i, p := range imp.batch {
+		switch err := errs[i]; {
+		case err == nil:
+			imp.report.Imported++
+		case errors.Is(err, postgres.ErrOrderExists):
+			imp.report.Duplicates++
+		default:
+			imp.report.fail(p.file, p.index, p.order.OrderUID, statusFailed, err.Error())
+		}
+	}
+
+	return nil
+}
+
+type storageSink struct {
+	storage *postgres.Storage
+}
+
+func (s *storageSink) Write(ctx context.Context, orders []models.Order) []error {
+	return s.storage.SaveOrders(ctx, orders)
+}
+
+func (s *storageSink) Close() error {
+	return s.storage.Close()
+}
+
+type kafkaSink struct {
+	producer *producer.Producer
+}
+
+// Write публикует заказы с ключом order_uid, чтобы один заказ всегда попадал в одну партицию
+func (s *kafkaSink) Write(ctx context.Context, orders []models.Order) []error {
+	return s.producer.PublishOrders(ctx, orders)
+}
+
+func (s *kafkaSink) Close() error {
+	return s.producer.Close()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	statusInvalid = "invalid"
+	statusFailed  = "failed"
+)
+
+type failure struct {
+	File     string   `json:"file"`
+	Index    int      `json:"index"`
+	OrderUID string   `json:"order_uid,omitempty"`
+	Status   string   `json:"status"`
+	Errors   []string `json:"errors"`
+}
+
+// report накапливает итоги импорта по всем файлам
+type report struct {
+	Mode       string    `json:"mode"`
+	DryRun     bool      `json:"dry_run"`
+	Total      int       `json:"total"`
+	Imported   int       `json:"imported"`
+	Duplicates int       `json:"duplicates"`
+	Invalid    int       `json:"invalid"`
+	Failed     int       `json:"failed"`
+	Duration   string    `json:"duration"`
+	Failures   []failure `json:"failures"`
+}
+
+func (r *report) fail(file string, index int, orderUID, status string, errs ...string) {
+	switch status {
+	case statusInvalid:
+		r.Invalid++
+	default:
+		r.Failed++
+	}
+
+	if len(r.Failures) < maxFailures {
+		r.Failures = append(r.Failures, failure{
+			File: file, Index: index, OrderUID: orderUID, Status: status, Errors: errs,
+		})
+	}
+}
+
+func (r *report) print() {
+	fmt.Printf("mode=%s dry_run=%t total=%d imported=%d duplicates=%d invalid=%d failed=%d duration=%s\n",
+		r.Mode, r.DryRun, r.Total, r.Imported, r.Duplicates, r.Invalid, r.Failed, r.Duration)
+
+	for _, f := range r.Failures {
+		fmt.Printf("  %s #%d %s [%s]: %s\n", f.File, f.Index, f.OrderUID, f.Status, strings.Join(f.Errors, "; "))
+	}
+	if skipped := r.Invalid + r.Failed - len(r.Failures); skipped > 0 {
+		fmt.Printf("  ... and %d more\n", skipped)
+	}
+}
+
+func (r *report) save(path string) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, b, 0o644)
+}
@@ -3,22 +3,35 @@ package main
 import (
 	"L0/internal/cache"
 	"L0/internal/config"
+	"L0/internal/consistency"
+	"L0/internal/http-server/conditional"
+	"L0/internal/http-server/handlers/admin"
 	"L0/internal/http-server/handlers/handler"
+	"L0/internal/http-server/handlers/openapi"
+	"L0/internal/http-server/middleware/auth"
 	"L0/internal/http-server/middleware/mwlogger"
+	"L0/internal/http-server/middleware/ratelimit"
+	"L0/internal/kafka/codec"
 	"L0/internal/kafka/consumer"
+	"L0/internal/kafka/headers"
 	"L0/internal/lib/logger/handlers/slogpretty"
 	"L0/internal/lib/logger/sl"
 	"L0/internal/service"
+	"L0/internal/source"
 	"L0/internal/storage/postgres"
 	"context"
+	"expvar"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/klauspost/compress/zstd"
+	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
 const (
@@ -49,9 +62,53 @@ func main() {
 	// Инициализируем кеши, сервис и кафку
 	orderCache := cache.New()
 
-	orderService := service.New(storage, orderCache)
+	// Проверка согласованности сумм необязательна: без нее заказы сохраняются без предупреждений
+	var checker *consistency.Checker
+	if cfg.Consistency.Enabled {
+		checker, err = consistency.New(cfg.Consistency)
+		if err != nil {
+			log.Error("failed to init consistency checker", sl.Err(err))
+			os.Exit(1)
+		}
+	}
 
-	kafkaConsumer := consumer.NewConsumer(cfg.Kafka, orderService)
+	orderService := service.New(storage, orderCache, checker)
+
+	codecs, err := codec.Default()
+	if err != nil {
+		log.Error("failed to init payload codecs", sl.Err(err))
+		os.Exit(1)
+	}
+	codecs.Register(codec.JSON{
+		Mode: cfg.Kafka.Decoding.Mode,
+		Log:  log.With(slog.String("component", "kafka/codec")),
+	})
+
+	// Карантин необязателен: без него необработанные сообщения только логируются
+	var quarantine consumer.Quarantine
+	if cfg.Kafka.Quarantine.Enabled {
+		quarantine = storage
+	}
+
+	kafkaConsumer, err := consumer.NewConsumer(cfg.Kafka, orderService, codecs, quarantine, log)
+	if err != nil {
+		log.Error("failed to init kafka consumer", sl.Err(err))
+		os.Exit(1)
+	}
+
+	if cfg.Inbox.Enabled {
+		inbox, err := source.NewDir(cfg.Inbox.Dir, cfg.Inbox.PollInterval)
+		if err != nil {
+			log.Error("failed to init inbox", sl.Err(err))
+			os.Exit(1)
+		}
+
+		inboxTopic := config.Topic{Name: "inbox:" + cfg.Inbox.Dir, Handler: headers.EventOrderCreated}
+		if err := kafkaConsumer.AddSource(inbox, inboxTopic, codec.ContentTypeJSON); err != nil {
+			log.Error("failed to add inbox source", sl.Err(err))
+			os.Exit(1)
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
@@ -59,28 +116,71 @@ func main() {
 
 	go kafkaConsumer.Run(ctx, wg)
 
+	authenticator, err := auth.New(cfg.Auth)
+	if err != nil {
+		log.Error("failed to init authenticator", sl.Err(err))
+		os.Exit(1)
+	}
+
+	go reloadOnSIGHUP(log, cfg, authenticator)
+
+	limiter := ratelimit.New(cfg.RateLimit)
+
 	// Запускаем http роутер
 	router := chi.NewRouter()
 
 	router.Use(middleware.RequestID)
+	router.Use(authenticator.Authenticate)
 	router.Use(mwlogger.New(log))
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.URLFormat)
+	router.Use(conditional.Encoded)
+	router.Use(compressor().Handler)
 
 	router.Handle("/", http.FileServer(http.Dir("./static")))
 	router.Handle("/static/*", http.StripPrefix("/static/", http.FileServer(http.Dir("./static"))))
 
+	// Метрики expvar, в том числе задержка от Kafka до сохранения
+	router.With(authenticator.Require(auth.RoleRead)).Handle("/debug/vars", expvar.Handler())
+
 	// API routes
 	router.Route("/api", func(r chi.Router) {
+		// URLFormat отрезает расширение, поэтому /api/openapi.json матчится на /openapi
+		r.Get("/openapi", openapi.SpecHandler) // GET /api/openapi.json
+		r.Get("/docs", openapi.UIHandler)      // GET /api/docs
+
+		r.With(
+			authenticator.Require(auth.RoleWrite),
+			limiter.Limit("orders.batch"),
+		).Post("/orders:batch", handler.NewBatchHandler(orderService, cfg.HTTPServer.Decoding, cfg.HTTPServer.Batch, log).CreateOrders) // POST /api/orders:batch
+
 		r.Route("/orders", func(r chi.Router) {
-			orderHandler := handler.NewOrderHandler(orderService)
+			orderHandler := handler.NewOrderHandler(orderService, cfg.HTTPServer.Decoding, log)
+
+			r.Group(func(r chi.Router) {
+				r.Use(authenticator.Require(auth.RoleRead))
+
+				r.With(limiter.Limit("orders.list")).Get("/", orderHandler.ListOrders)        // GET /api/orders
+				r.With(limiter.Limit("orders.get")).Get("/{orderUID}", orderHandler.GetOrder) // GET /api/orders/123
+			})
 
-			r.Get("/", orderHandler.ListOrders)         // GET /api/orders
-			r.Post("/", orderHandler.CreateOrder)       // POST /api/orders
-			r.Get("/{orderUID}", orderHandler.GetOrder) // GET /api/orders/123
+			r.Group(func(r chi.Router) {
+				r.Use(authenticator.Require(auth.RoleWrite))
+
+				r.With(limiter.Limit("orders.create")).Post("/", orderHandler.CreateOrder) // POST /api/orders
+			})
 		})
 	})
 
+	if cfg.Admin.Enabled {
+		var quarantineHandler *admin.QuarantineHandler
+		if cfg.Kafka.Quarantine.Enabled {
+			quarantineHandler = admin.NewQuarantineHandler(storage, orderService, codecs, cfg.Kafka.Decoding.MaxBytes, log)
+		}
+
+		go serveAdmin(log, cfg.Admin, authenticator, kafkaConsumer, quarantineHandler)
+	}
+
 	log.Info("starting server", slog.String("address", cfg.HTTPServer.Address))
 
 	// Запускаем сервер
@@ -116,6 +216,103 @@ func main() {
 	log.Info("postgres connection closed")
 }
 
+// serveAdmin запускает админский сервер на отдельном адресе, чтобы управление
+// консюмером не было доступно через публичный API
+func serveAdmin(log *slog.Logger, cfg config.Admin, authenticator *auth.Authenticator, kafkaConsumer *consumer.Consumer, quarantineHandler *admin.QuarantineHandler) {
+	router := chi.NewRouter()
+
+	router.Use(middleware.RequestID)
+	router.Use(authenticator.Authenticate)
+	router.Use(mwlogger.New(log))
+	router.Use(middleware.Recoverer)
+
+	router.Route("/admin/consumer", func(r chi.Router) {
+		consumerHandler := admin.NewConsumerHandler(kafkaConsumer)
+
+		r.With(authenticator.Require(auth.RoleRead)).Get("/", consumerHandler.Stats) // GET /admin/consumer
+
+		r.Group(func(r chi.Router) {
+			r.Use(authenticator.Require(auth.RoleWrite))
+
+			r.Post("/pause", consumerHandler.Pause)   // POST /admin/consumer/pause
+			r.Post("/resume", consumerHandler.Resume) // POST /admin/consumer/resume
+		})
+	})
+
+	if quarantineHandler != nil {
+		router.Route("/admin/quarantine", func(r chi.Router) {
+			r.Group(func(r chi.Router) {
+				r.Use(authenticator.Require(auth.RoleRead))
+
+				r.Get("/", quarantineHandler.List)    // GET /admin/quarantine
+				r.Get("/{id}", quarantineHandler.Get) // GET /admin/quarantine/{id}
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(authenticator.Require(auth.RoleWrite))
+
+				r.Put("/{id}/payload", quarantineHandler.UpdatePayload) // PUT /admin/quarantine/{id}/payload
+				r.Post("/{id}/resubmit", quarantineHandler.Resubmit)    // POST /admin/quarantine/{id}/resubmit
+			})
+		})
+	}
+
+	log.Info("starting admin server", slog.String("address", cfg.Address))
+
+	srv := &http.Server{
+		Addr:              cfg.Address,
+		Handler:           router,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	if err := srv.ListenAndServe(); err != nil {
+		log.Error("failed to start admin server", sl.Err(err))
+	}
+}
+
+// compressor сжимает ответы gzip, deflate или zstd по Accept-Encoding, zstd в приоритете
+func compressor() *middleware.Compressor {
+	c := middleware.NewCompressor(5,
+		"application/json",
+		"application/x-ndjson",
+		"text/csv",
+		"text/html",
+		"text/css",
+		"text/javascript",
+	)
+
+	c.SetEncoder("zstd", func(w io.Writer, level int) io.Writer {
+		enc, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		if err != nil {
+			return nil
+		}
+		return enc
+	})
+
+	return c
+}
+
+// reloadOnSIGHUP перечитывает конфиг по SIGHUP и обновляет ключи доступа без рестарта
+func reloadOnSIGHUP(log *slog.Logger, cfg *config.Config, authenticator *auth.Authenticator) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		newCfg, err := cfg.Reload()
+		if err != nil {
+			log.Error("failed to reload config", sl.Err(err))
+			continue
+		}
+
+		if err := authenticator.Update(newCfg.Auth); err != nil {
+			log.Error("failed to reload auth keys", sl.Err(err))
+			continue
+		}
+
+		log.Info("auth keys reloaded")
+	}
+}
+
 // setupLogger создает логгер с различными хендерами и уровнями логирования в зависимости от окружения
 func setupLogger(env string) *slog.Logger {
 	var log *slog.Logger
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type probe struct {
+	orderUID string
+	sentAt   time.Time
+}
+
+// benchmark опрашивает HTTP API, пока отправленный заказ не станет доступен,
+// и собирает задержки от отправки до видимости. Каждый заказ опрашивается своей горутиной
+// с момента отправки, число одновременных опросов ограничено семафором. Заказ, для которого
+// нет свободного места, не отслеживается и учитывается в dropped, чтобы не тормозить отправку
+type benchmark struct {
+	ctx      context.Context
+	client   *http.Client
+	baseURL  string
+	apiKey   string
+	timeout  time.Duration
+	interval time.Duration
+
+	sem chan struct{}
+	wg  sync.WaitGroup
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	timeouts  atomic.Int64
+	dropped   atomic.Int64
+}
+
+// newBenchmark создает замер, который опрашивает не больше pollers заказов одновременно.
+// Опросы прерываются отменой ctx
+func newBenchmark(ctx context.Context, baseURL, apiKey string, timeout time.Duration, pollers int) *benchmark {
+	return &benchmark{
+		ctx:      ctx,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		baseURL:  baseURL,
+		apiKey:   apiKey,
+		timeout:  timeout,
+		interval: 10 * time.Millisecond,
+		sem:      make(chan struct{}, max(pollers, 1)),
+	}
+}
+
+// track начинает опрос заказа сразу после отправки и никогда не блокирует отправку
+func (b *benchmark) track(orderUID string, sentAt time.Time) {
+	select {
+	case b.sem <- struct{}{}:
+	default:
+		b.dropped.Add(1)
+		return
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer func() { <-b.sem }()
+		b.poll(b.ctx, probe{orderUID: orderUID, sentAt: sentAt})
+	}()
+}
+
+// wait дожидается всех начатых опросов
+func (b *benchmark) wait() {
+	b.wg.Wait()
+}
+
+func (b *benchmark) poll(ctx context.Context, p probe) {
+	deadline := p.sentAt.Add(b.timeout)
+	target := b.baseURL + "/api/orders/" + url.PathEscape(p.orderUID)
+
+	// Таймер вместо time.Sleep, чтобы отмена ctx не ждала конца интервала
+	timer := time.NewTimer(b.interval)
+	defer timer.Stop()
+
+	for time.Now().Before(deadline) {
+		if b.visible(ctx, target) {
+			latency := time.Since(p.sentAt)
+			b.mu.Lock()
+			b.latencies = append(b.latencies, latency)
+			b.mu.Unlock()
+			return
+		}
+
+		timer.Reset(b.interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+	}
+
+	b.timeouts.Add(1)
+}
+
+func (b *benchmark) visible(ctx context.Context, target string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return false
+	}
+	if b.apiKey != "" {
+		req.Header.Set("X-API-Key", b.apiKey)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+
+	return resp.StatusCode == http.StatusOK
+}
+
+func (b *benchmark) report() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.latencies) == 0 {
+		log.Printf("ingest-to-visible: no orders became visible, %d timed out, %d not tracked",
+			b.timeouts.Load(), b.dropped.Load())
+		return
+	}
+
+	slices.Sort(b.latencies)
+	log.Printf("ingest-to-visible over %d orders (%d timed out, %d not tracked): p50=%s p95=%s p99=%s max=%s",
+		len(b.latencies), b.timeouts.Load(), b.dropped.Load(),
+		percentile(b.latencies, 0.50), percentile(b.latencies, 0.95),
+		percentile(b.latencies, 0.99), b.latencies[len(b.latencies)-1])
+}
+
+// percentile считает перцентиль методом nearest-rank по отсортированной выборке
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(float64(len(sorted))*q+0.5) - 1
+	i = max(0, min(i, len(sorted)-1))
+	return sorted[i].Round(time.Millisecond)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"L0/internal/lib/money"
+	"L0/internal/models"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+type city struct {
+	name   string
+	region string
+	zip    string
+}
+
+var (
+	cities = []city{
+		{"Moscow", "Moscow", "101000"},
+		{"Saint Petersburg", "Leningrad Oblast", "190000"},
+		{"Kazan", "Tatarstan", "420000"},
+		{"Novosibirsk", "Novosibirsk Oblast", "630000"},
+		{"Yekaterinburg", "Sverdlovsk Oblast", "620000"},
+		{"Nizhny Novgorod", "Nizhny Novgorod Oblast", "603000"},
+		{"Samara", "Samara Oblast", "443000"},
+		{"Krasnodar", "Krasnodar Krai", "350000"},
+		{"Rostov-on-Don", "Rostov Oblast", "344000"},
+	}
+	firstNames = []string{"Ivan", "Anna", "Sergey", "Olga", "Dmitry", "Maria", "Alexey", "Elena", "Natalia"}
+	lastNames  = []string{"Ivanov", "Petrova", "Smirnov", "Kuznetsova", "Popov", "Sokolova", "Volkov"}
+	streets    = []string{"Lenina", "Pushkina", "Gagarina", "Mira", "Sovetskaya", "Tverskaya"}
+	brands     = []string{"Vivienne Sabo", "Nike", "Adidas", "Samsung", "Xiaomi", "Lego", "Zara"}
+	products   = []string{"Mascaras", "Sneakers", "T-shirt", "Phone case", "Headphones", "Backpack", "Jacket"}
+	sizes      = []string{"0", "S", "M", "L", "XL", "42", "44"}
+	providers  = []string{"wbpay", "sbp", "card"}
+	banks      = []string{"alpha", "sber", "tinkoff", "vtb"}
+	services   = []string{"meest", "cdek", "boxberry", "pochta"}
+	currencies = []string{"RUB", "RUB", "RUB", "USD", "EUR"}
+	locales    = []string{"ru", "en"}
+)
+
+// generator выдает случайные, но согласованные заказы. При одинаковых seed и now
+// последовательность заказов повторяется
+type generator struct {
+	rnd             *rand.Rand
+	invalidFraction float64
+	now             time.Time
+}
+
+func newGenerator(seed uint64, now time.Time, invalidFraction float64) *generator {
+	return &generator{
+		rnd:             rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15)),
+		invalidFraction: invalidFraction,
+		now:             now,
+	}
+}
+
+// Next возвращает следующий заказ. Для намеренно битого сообщения второе значение
+// содержит испорченное тело, которое нужно отправить вместо заказа
+func (g *generator) Next() (models.Order, []byte) {
+	order := g.order()
+
+	if g.invalidFraction > 0 && g.rnd.Float64() < g.invalidFraction {
+		return order, g.corrupt(order)
+	}
+
+	return order, nil
+}
+
+// must возвращает сумму генератора. Суммы генератора на порядки меньше границ
+// money.Amount, поэтому ошибка означает ошибку в самом генераторе
+func must(a money.Amount, err error) money.Amount {
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func (g *generator) order() models.Order {
+	uid := g.hex(20)
+	track := "WBIL" + strings.ToUpper(g.hex(6)) + "TRACK"
+	c := pick(g.rnd, cities)
+	first, last := pick(g.rnd, firstNames), pick(g.rnd, lastNames)
+
+	// Цены с копейками, итог товара считается со скидкой и округлением до минорной единицы
+	currency := money.CurrencyOf(pick(g.rnd, currencies))
+	items := make([]models.Item, 1+g.rnd.IntN(5))
+	var goodsTotal money.Amount
+	for i := range items {
+		price := must(money.FromMinor(10_000+g.rnd.Int64N(5_000_000), currency))
+		sale := g.rnd.IntN(10) * 5
+		total := price.Discount(sale, currency)
+		goodsTotal += total
+
+		items[i] = models.Item{
+			ChrtID:      1_000_000 + g.rnd.Int64N(9_000_000),
+			TrackNumber: track,
+			Price:       price,
+			RID:         g.hex(20),
+			Name:        pick(g.rnd, products),
+			Sale:        sale,
+			Size:        pick(g.rnd, sizes),
+			TotalPrice:  total,
+			NmID:        1_000_000 + g.rnd.Int64N(9_000_000),
+			Brand:       pick(g.rnd, brands),
+			Status:      202,
+		}
+	}
+
+	deliveryCost := must(money.Major(100 * g.rnd.Int64N(20)))
+	var customFee money.Amount
+	if g.rnd.IntN(10) == 0 {
+		customFee = must(money.Major(10 * g.rnd.Int64N(100)))
+	}
+
+	created := g.now.Add(-time.Duration(g.rnd.Int64N(int64(30 * 24 * time.Hour)))).UTC().Truncate(time.Second)
+
+	return models.Order{
+		OrderUID:    uid,
+		TrackNumber: track,
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    first + " " + last,
+			Phone:   fmt.Sprintf("+79%09d", g.rnd.IntN(1_000_000_000)),
+			Zip:     c.zip,
+			City:    c.name,
+			Address: fmt.Sprintf("%s %d", pick(g.rnd, streets), 1+g.rnd.IntN(150)),
+			Region:  c.region,
+			Email:   strings.ToLower(first+"."+last) + "@example.com",
+		},
+		Payment: models.Payment{
+			Transaction:  uid,
+			Currency:     currency.Code,
+			Provider:     pick(g.rnd, providers),
+			Amount:       must(money.Sum(goodsTotal, deliveryCost, customFee)),
+			PaymentDT:    created.Unix(),
+			Bank:         pick(g.rnd, banks),
+			DeliveryCost: deliveryCost,
+			GoodsTotal:   goodsTotal,
+			CustomFee:    customFee,
+		},
+		Items:           items,
+		Locale:          pick(g.rnd, locales),
+		CustomerID:      "customer-" + g.hex(4),
+		DeliveryService: pick(g.rnd, services),
+		Shardkey:        fmt.Sprint(g.rnd.IntN(10)),
+		SmID:            g.rnd.IntN(100),
+		DateCreated:     created,
+		OofShard:        fmt.Sprint(1 + g.rnd.IntN(2)),
+	}
+}
+
+// corrupt портит заказ одним из способов: битый JSON, пропущенные поля, неверные типы или суммы
+func (g *generator) corrupt(order models.Order) []byte {
+	switch g.rnd.IntN(4) {
+	case 0:
+		value, _ := json.Marshal(order)
+		return value[:len(value)/2]
+	case 1:
+		order.OrderUID = ""
+		order.Delivery = models.Delivery{}
+		value, _ := json.Marshal(order)
+		return value
+	case 2:
+		order.Payment.Amount = -order.Payment.Amount
+		order.Items[0].Sale = 150
+		value, _ := json.Marshal(order)
+		return value
+	default:
+		return []byte(fmt.Sprintf(`{"order_uid":%q,"sm_id":"not-a-number","items":{}}`, order.OrderUID))
+	}
+}
+
+func (g *generator) hex(n int) string {
+	const digits = "0123456789abcdef"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = digits[g.rnd.IntN(len(digits))]
+	}
+	return string(b)
+}
+
+func pick[T any](rnd *rand.Rand, values []T) T {
+	return values[rnd.IntN(len(values))]
+}
@@ -2,82 +2,182 @@ package main
 
 import (
 	"L0/internal/config"
+	"L0/internal/kafka/headers"
+	"L0/internal/kafka/producer"
 	"L0/internal/models"
 	"context"
-	"encoding/json"
-	"github.com/segmentio/kafka-go"
+	"flag"
 	"log"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+
+	"golang.org/x/time/rate"
 )
 
+type options struct {
+	count           int
+	rate            float64
+	concurrency     int
+	seed            uint64
+	baseTime        string
+	invalidFraction float64
+
+	bench        bool
+	apiURL       string
+	apiKey       string
+	benchTimeout time.Duration
+	benchPollers int
+}
+
+// sourceSystem представляет продюсер в заголовке source-system
+const sourceSystem = "order-producer"
+
+type message struct {
+	order   models.Order
+	corrupt []byte
+}
+
 func main() {
+	var opts options
+
+	// Флаги определяются до config.MustLoad, который сам вызывает flag.Parse
+	flag.IntVar(&opts.count, "count", 1, "total number of messages to send")
+	flag.Float64Var(&opts.rate, "rate", 0, "messages per second, 0 for unlimited")
+	flag.IntVar(&opts.concurrency, "concurrency", 1, "number of concurrent senders")
+	flag.Uint64Var(&opts.seed, "seed", 0, "random seed, 0 picks one from the clock")
+	flag.StringVar(&opts.baseTime, "base-time", "", "RFC3339 time date_created is counted back from, defaults to now")
+	flag.Float64Var(&opts.invalidFraction, "invalid", 0, "fraction of malformed or invalid messages, from 0 to 1")
+	flag.BoolVar(&opts.bench, "bench", false, "measure ingest-to-visible latency by polling the HTTP API")
+	flag.StringVar(&opts.apiURL, "api", "", "base URL of the order service, defaults to http_server.address")
+	flag.StringVar(&opts.apiKey, "api-key", "", "API key used when polling")
+	flag.DurationVar(&opts.benchTimeout, "bench-timeout", 30*time.Second, "give up on an order after this time")
+	flag.IntVar(&opts.benchPollers, "bench-pollers", 256, "max orders polled concurrently, orders above the limit are not tracked")
+
 	cfg := config.MustLoad()
 
-	// Создаем объект продюсера
-	writer := kafka.Writer{
-		Addr:  kafka.TCP(cfg.Kafka.Brokers[0]),
-		Topic: cfg.Kafka.Topic,
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
+	if opts.seed == 0 {
+		opts.seed = uint64(time.Now().UnixNano())
+	}
+	baseTime := time.Now()
+	if opts.baseTime != "" {
+		var err error
+		if baseTime, err = time.Parse(time.RFC3339, opts.baseTime); err != nil {
+			log.Fatalf("invalid -base-time: %v", err)
+		}
 	}
+	log.Printf("seed %d, base time %s", opts.seed, baseTime.Format(time.RFC3339))
 
-	// Заполняем тестовые данные для отправки
-	order := models.Order{
-		OrderUID:    "test123",
-		TrackNumber: "123456",
-		Entry:       "123456",
-		Delivery: models.Delivery{
-			Name:    "Vasya",
-			Phone:   "89123456789",
-			Zip:     "111",
-			City:    "Moscow",
-			Address: "Russia",
-			Region:  "VAO",
-			Email:   "email@gmail.com",
-		},
-		Payment: models.Payment{
-			Transaction:  "tra",
-			RequestID:    "reqID",
-			Currency:     "USD",
-			Provider:     "WB",
-			Amount:       560,
-			PaymentDT:    23456,
-			Bank:         "wb",
-			DeliveryCost: 145654,
-			GoodsTotal:   111,
-			CustomFee:    222,
-		},
-		Items: []models.Item{
-			models.Item{
-				ChrtID:      12345,
-				TrackNumber: "1212",
-				Price:       12345,
-				RID:         "fff",
-				Name:        "adfa",
-				Sale:        10,
-				Size:        "10",
-				TotalPrice:  1999,
-				NmID:        234324232,
-				Brand:       "channel",
-				Status:      1,
-			},
-		},
-		Locale:            "locale",
-		InternalSignature: "a1",
-		CustomerID:        "12345fs1212",
-		DeliveryService:   "samokat",
-		Shardkey:          "22222",
-		SmID:              1234323231,
-		DateCreated:       time.Now(),
-		OofShard:          "oof",
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var bench *benchmark
+	if opts.bench {
+		if opts.apiURL == "" {
+			opts.apiURL = "http://" + cfg.HTTPServer.Address
+		}
+		bench = newBenchmark(ctx, opts.apiURL, opts.apiKey, opts.benchTimeout, opts.benchPollers)
 	}
 
-	value, _ := json.Marshal(order)
-	err := writer.WriteMessages(context.Background(),
-		kafka.Message{
-			Value: value,
-		},
+	var (
+		sent, invalid, failed atomic.Int64
+		invalidKeys           sync.Map
 	)
+	record := func(key string, sentAt time.Time, err error) {
+		if err != nil {
+			failed.Add(1)
+			log.Printf("failed to send %s: %v", key, err)
+			return
+		}
+		sent.Add(1)
+		if _, bad := invalidKeys.LoadAndDelete(key); bad {
+			invalid.Add(1)
+		} else if bench != nil {
+			bench.track(key, sentAt)
+		}
+	}
+
+	// В асинхронном режиме результат доставки известен только в колбэке продюсера
+	async := cfg.Kafka.Producer.Async
+	var onDelivery producer.DeliveryFunc
+	if async {
+		onDelivery = func(d producer.Delivery) {
+			record(d.Key, d.SentAt, d.Err)
+		}
+	}
+
+	pub, err := producer.New(cfg.Kafka, sourceSystem, onDelivery)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("failed to init producer: %v", err)
+	}
+	messages := make(chan message, opts.concurrency)
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := 0; i < opts.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range messages {
+				sentAt := time.Now()
+				var err error
+				if msg.corrupt != nil {
+					invalidKeys.Store(msg.order.OrderUID, struct{}{})
+					err = pub.Publish(ctx, msg.order.OrderUID, msg.corrupt, headers.Metadata{SentAt: sentAt})
+				} else {
+					err = pub.PublishOrder(ctx, msg.order)
+				}
+				// Ошибка асинхронной публикации означает, что сообщение не попало в очередь
+				// и колбэк для него не будет вызван
+				if !async || err != nil {
+					record(msg.order.OrderUID, sentAt, err)
+				}
+			}
+		}()
+	}
+
+	// Генерация идет в одной горутине, чтобы последовательность зависела только от seed
+	gen := newGenerator(opts.seed, baseTime, opts.invalidFraction)
+	var limiter *rate.Limiter
+	if opts.rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.rate), 1)
+	}
+
+generate:
+	for i := 0; i < opts.count; i++ {
+		if limiter != nil {
+			if err := limiter.Wait(ctx); err != nil {
+				break
+			}
+		}
+
+		order, corrupt := gen.Next()
+		select {
+		case messages <- message{order: order, corrupt: corrupt}:
+		case <-ctx.Done():
+			break generate
+		}
+	}
+	close(messages)
+	wg.Wait()
+
+	// Close дожидается доставки накопленных сообщений, после него колбэк больше не вызывается
+	if err := pub.Close(); err != nil {
+		log.Printf("failed to close producer: %v", err)
+	}
+
+	elapsed := time.Since(start)
+	log.Printf("sent %d messages (%d invalid), %d failed in %s: %.1f msg/s",
+		sent.Load(), invalid.Load(), failed.Load(), elapsed.Round(time.Millisecond),
+		float64(sent.Load())/elapsed.Seconds())
+
+	if bench != nil {
+		bench.wait()
+		bench.report()
 	}
-	log.Println("message sent")
 }
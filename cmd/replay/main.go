@@ -0,0 +1,111 @@
+package main
+
+import (
+	"L0/internal/config"
+	"L0/internal/kafka/replay"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+// usage объясняет, что перемотка только повторяет доставку: режима перезаписи нет
+const usage = `usage: replay -to earliest|latest|2024-01-02T15:04:05Z|0:120,1:98 [-topic name] [-dry-run]
+
+Rewinds the consumer group so that the stopped service reads the messages again.
+Replay does not overwrite stored data: orders and events that are already stored
+are acknowledged unchanged and counted as duplicates. To correct a stored order,
+delete it from the database before replaying.
+`
+
+func main() {
+	var (
+		to     string
+		topic  string
+		dryRun bool
+	)
+
+	// Флаги определяются до config.MustLoad, который сам вызывает flag.Parse
+	flag.StringVar(&to, "to", "", "earliest, latest, RFC3339 time or partition:offset list, e.g. 0:120,1:98")
+	flag.StringVar(&topic, "topic", "", "topic to rewind, all topics of the consumer group by default")
+	flag.BoolVar(&dryRun, "dry-run", false, "only print target offsets, commit nothing")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage+"\n")
+		flag.PrintDefaults()
+	}
+
+	cfg := config.MustLoad()
+
+	if to == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	target, err := replay.ParseTarget(to)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	topics := cfg.Kafka.TopicNames()
+	if topic != "" {
+		topics = []string{topic}
+	}
+	// Номера партиций относятся к одному топику
+	if target.Position == replay.PositionOffsets && len(topics) > 1 {
+		log.Fatalf("partition:offset target needs -topic, the group reads %s", strings.Join(topics, ", "))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Сначала планируем все топики, чтобы ошибка в одном не оставила группу перемотанной частично
+	resetters := make([]*replay.Resetter, len(topics))
+	plans := make([][]replay.Assignment, len(topics))
+	for i, name := range topics {
+		resetters[i], err = replay.New(cfg.Kafka, name)
+		if err != nil {
+			log.Fatalf("failed to init kafka client: %v", err)
+		}
+
+		plans[i], err = resetters[i].Plan(ctx, target)
+		if err != nil {
+			log.Fatalf("failed to plan replay of %s: %v", name, err)
+		}
+
+		fmt.Printf("topic=%s group=%s target=%s dry_run=%t\n", name, cfg.Kafka.GroupID, to, dryRun)
+		printPlan(plans[i])
+	}
+
+	if dryRun {
+		return
+	}
+
+	for i, r := range resetters {
+		if err := r.Apply(ctx, plans[i]); err != nil {
+			log.Fatalf("failed to reset offsets of %s: %v", r.Topic(), err)
+		}
+	}
+
+	fmt.Println("offsets committed, start the service to reprocess messages")
+	fmt.Println("orders and events that are already stored are not updated, they are counted as duplicates")
+}
+
+func printPlan(plan []replay.Assignment) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "PARTITION\tFIRST\tLAST\tCOMMITTED\tTARGET\tTO REPLAY")
+	for _, a := range plan {
+		committed := "-"
+		if a.Committed >= 0 {
+			committed = fmt.Sprint(a.Committed)
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%d\t%d\n", a.Partition, a.First, a.Last, committed, a.Target, a.Last-a.Target)
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("failed to print plan: %v", err)
+	}
+}
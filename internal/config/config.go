@@ -1,18 +1,29 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/ilyakaznacheev/cleanenv"
 	"os"
+	"slices"
+	"strings"
 	"time"
 )
 
 // Config анмаршлит данные из конфига в структуры
 type Config struct {
-	Env        string     `yaml:"env" env-default:"local"`
-	Database   Database   `yaml:"database"`
-	HTTPServer HTTPServer `yaml:"http_server"`
-	Kafka      Kafka      `yaml:"kafka"`
+	Env         string      `yaml:"env" env-default:"local"`
+	Database    Database    `yaml:"database"`
+	HTTPServer  HTTPServer  `yaml:"http_server"`
+	Kafka       Kafka       `yaml:"kafka"`
+	Auth        Auth        `yaml:"auth"`
+	RateLimit   RateLimit   `yaml:"rate_limit"`
+	Admin       Admin       `yaml:"admin"`
+	Inbox       Inbox       `yaml:"inbox"`
+	Consistency Consistency `yaml:"consistency"`
+
+	path string
 }
 
 type Database struct {
@@ -28,6 +39,15 @@ type HTTPServer struct {
 	Address     string        `yaml:"address" env-default:"localhost:8064"`
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	Batch       Batch         `yaml:"batch"`
+	Decoding    Decoding      `yaml:"decoding"`
+}
+
+// Batch ограничивает пакетную загрузку заказов через POST /api/orders:batch
+type Batch struct {
+	MaxBytes  int64         `yaml:"max_bytes" env-default:"33554432"`
+	MaxOrders int           `yaml:"max_orders" env-default:"10000"`
+	Timeout   time.Duration `yaml:"timeout" env-default:"2m"`
 }
 
 type Kafka struct {
@@ -35,7 +55,186 @@ type Kafka struct {
 	Topic           string   `yaml:"topic" env-required:"true"`
 	GroupID         string   `yaml:"group_id" env-default:"order-service"`
 	AutoOffsetReset string   `yaml:"auto_offset_reset" env-default:"earliest"`
-	MaxPollRecords  int      `yaml:"max_poll_records" env-default:"1"`
+	// MaxPollRecords ограничивает число прочитанных, но еще не отданных воркерам сообщений
+	MaxPollRecords int         `yaml:"max_poll_records" env-default:"100"`
+	Reader         KafkaReader `yaml:"reader"`
+	// Producer настраивает публикацию для продюсеров и импортера
+	Producer KafkaProducer `yaml:"producer"`
+	// ContentType задает формат сообщений топика, если продюсер не прислал заголовок content-type
+	ContentType string   `yaml:"content_type" env-default:"application/json"`
+	Decoding    Decoding `yaml:"decoding"`
+	// Topics перечисляет дополнительные топики с событиями заказов. Topic читается всегда
+	// обработчиком order.created, запись с тем же именем переопределяет его настройки
+	Topics []Topic `yaml:"topics"`
+	// Quarantine включает сохранение необработанных сообщений в таблицу quarantined_messages
+	Quarantine Quarantine `yaml:"quarantine"`
+	// TLS и SASL общие для консюмера, продюсеров и утилит
+	TLS  KafkaTLS  `yaml:"tls"`
+	SASL KafkaSASL `yaml:"sasl"`
+}
+
+// Стратегии распределения партиций между участниками группы
+const (
+	AssignRange      = "range"
+	AssignRoundRobin = "round_robin"
+)
+
+// KafkaReader настраивает чтение из Kafka. Умолчания совпадают с умолчаниями kafka-go,
+// кроме MaxBytes. CommitInterval 0 коммитит синхронно после каждого сообщения
+type KafkaReader struct {
+	MinBytes            int           `yaml:"min_bytes" env-default:"1"`
+	MaxBytes            int           `yaml:"max_bytes" env-default:"10000000"`
+	MaxWait             time.Duration `yaml:"max_wait" env-default:"10s"`
+	CommitInterval      time.Duration `yaml:"commit_interval" env-default:"0s"`
+	SessionTimeout      time.Duration `yaml:"session_timeout" env-default:"30s"`
+	HeartbeatInterval   time.Duration `yaml:"heartbeat_interval" env-default:"3s"`
+	RebalanceTimeout    time.Duration `yaml:"rebalance_timeout" env-default:"30s"`
+	IsolationLevel      string        `yaml:"isolation_level" env-default:"read_uncommitted"`
+	PartitionAssignment []string      `yaml:"partition_assignment" env-default:"range,round_robin"`
+}
+
+// Допустимые значения KafkaProducer.Compression и KafkaProducer.RequiredAcks
+var (
+	compressions = []string{"none", "gzip", "snappy", "lz4", "zstd"}
+	requiredAcks = []string{"none", "one", "all"}
+)
+
+// KafkaProducer настраивает публикацию в Kafka. В режиме Async публикация не ждет
+// подтверждения брокера, результат доставки приходит в колбэк продюсера
+type KafkaProducer struct {
+	Compression  string        `yaml:"compression" env-default:"none"`
+	RequiredAcks string        `yaml:"required_acks" env-default:"all"`
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"10"`
+	BatchSize    int           `yaml:"batch_size" env-default:"100"`
+	BatchTimeout time.Duration `yaml:"batch_timeout" env-default:"10ms"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env-default:"10s"`
+	Async        bool          `yaml:"async" env-default:"false"`
+}
+
+// KafkaTLS включает TLS до брокеров. CAFile добавляется к системным корневым сертификатам,
+// CertFile и KeyFile задают клиентский сертификат для mTLS
+type KafkaTLS struct {
+	Enabled            bool   `yaml:"enabled" env-default:"false"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" env-default:"false"`
+}
+
+// SASL механизмы аутентификации в Kafka
+const (
+	SASLPlain       = "PLAIN"
+	SASLScramSHA256 = "SCRAM-SHA-256"
+	SASLScramSHA512 = "SCRAM-SHA-512"
+)
+
+// KafkaSASL задает аутентификацию в Kafka. Пустой Mechanism ее отключает
+type KafkaSASL struct {
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+}
+
+// Quarantine описывает карантин сообщений, которые не удалось обработать
+type Quarantine struct {
+	Enabled bool `yaml:"enabled" env-default:"false"`
+}
+
+// Topic связывает топик с обработчиком. OnError задает реакцию на ошибку обработки:
+// skip пропускает сообщение, retry повторяет MaxRetries раз, pause после повторов
+// ставит консюмер на паузу до ручного resume. Нулевые значения заменяются умолчаниями
+type Topic struct {
+	Name         string        `yaml:"name"`
+	Handler      string        `yaml:"handler"`
+	Concurrency  int           `yaml:"concurrency"`
+	OnError      string        `yaml:"on_error"`
+	MaxRetries   int           `yaml:"max_retries"`
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+}
+
+// TopicNames перечисляет все топики, которые читает консюмер группы GroupID:
+// сначала Topic, затем Topics без повторов
+func (k Kafka) TopicNames() []string {
+	names := []string{k.Topic}
+	for _, t := range k.Topics {
+		if !slices.Contains(names, t.Name) {
+			names = append(names, t.Name)
+		}
+	}
+
+	return names
+}
+
+// Inbox включает загрузку заказов из NDJSON файлов, которые кладут в каталог Dir.
+// Каталог проверяется раз в PollInterval, файлы обрабатываются по одному в порядке имен
+type Inbox struct {
+	Enabled      bool          `yaml:"enabled" env-default:"false"`
+	Dir          string        `yaml:"dir"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"5s"`
+}
+
+// Consistency включает проверку денежной согласованности заказов при приеме. Нарушения
+// не отклоняют заказ, а сохраняются в нем предупреждениями. ToleranceMinor задает
+// допустимое расхождение в минорных единицах валюты заказа, пустой Rules включает все правила
+type Consistency struct {
+	Enabled        bool     `yaml:"enabled" env-default:"false"`
+	ToleranceMinor int64    `yaml:"tolerance_minor" env-default:"0"`
+	Rules          []string `yaml:"rules"`
+}
+
+// Admin описывает отдельный HTTP сервер для управления сервисом. Его адрес
+// не стоит открывать наружу, доступ дополнительно проверяется ролями, поэтому
+// включить его можно только вместе с Auth
+type Admin struct {
+	Enabled bool   `yaml:"enabled" env-default:"false"`
+	Address string `yaml:"address" env-default:"localhost:8065"`
+}
+
+// Decoding задает разбор входящего JSON: режим strict, lenient или logged
+// и максимальный размер тела запроса или сообщения в байтах
+type Decoding struct {
+	Mode     string `yaml:"mode" env-default:"logged"`
+	MaxBytes int64  `yaml:"max_bytes" env-default:"1048576"`
+}
+
+// Auth описывает ключи доступа к API. Ключи можно ротировать без рестарта,
+// перечитав конфиг по SIGHUP
+type Auth struct {
+	Enabled bool     `yaml:"enabled" env-default:"false"`
+	APIKeys []APIKey `yaml:"api_keys"`
+	JWT     JWT      `yaml:"jwt"`
+}
+
+type APIKey struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+	Role string `yaml:"role" env-default:"read"`
+}
+
+type JWT struct {
+	Issuer   string   `yaml:"issuer"`
+	Audience string   `yaml:"audience"`
+	Keys     []JWTKey `yaml:"keys"`
+}
+
+// JWTKey является HMAC ключом, kid токена выбирает ключ по ID
+type JWTKey struct {
+	ID     string `yaml:"id"`
+	Secret string `yaml:"secret"`
+}
+
+// RateLimit задает лимиты запросов на клиента. Routes переопределяет Default для отдельных роутов
+type RateLimit struct {
+	Enabled    bool             `yaml:"enabled" env-default:"false"`
+	Default    Limit            `yaml:"default"`
+	Routes     map[string]Limit `yaml:"routes"`
+	MaxClients int              `yaml:"max_clients" env-default:"10000"`
+}
+
+// Limit описывает token bucket: RPS токенов в секунду, не больше Burst за раз
+type Limit struct {
+	RPS   float64 `yaml:"rps" env-default:"10"`
+	Burst int     `yaml:"burst" env-default:"20"`
 }
 
 // MustLoad выгружает данные с конфига по пути до файла
@@ -50,17 +249,220 @@ func MustLoad() *Config {
 }
 
 func MustLoadByPath(configPath string) *Config {
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		panic("config file does not exist: " + configPath)
+	cfg, err := LoadByPath(configPath)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return cfg
+}
+
+// LoadByPath читает конфиг по пути до файла, возвращая ошибку вместо паники
+func LoadByPath(configPath string) (*Config, error) {
+	if _, err := os.Stat(configPath); errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("config file does not exist: %s", configPath)
 	}
 
 	var cfg Config
 
 	if err := cleanenv.ReadConfig(configPath, &cfg); err != nil {
-		panic("cannot read config" + err.Error())
+		return nil, fmt.Errorf("cannot read config: %w", err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	cfg.path = configPath
+
+	return &cfg, nil
+}
+
+// validate проверяет значения, которые cleanenv не может проверить сам
+func (c *Config) validate() error {
+	switch c.Kafka.AutoOffsetReset {
+	case "earliest", "latest":
+	default:
+		return fmt.Errorf("kafka.auto_offset_reset must be earliest or latest, got %q", c.Kafka.AutoOffsetReset)
+	}
+
+	for i, t := range c.Kafka.Topics {
+		if t.Name == "" {
+			return fmt.Errorf("kafka.topics[%d].name is required", i)
+		}
+		if t.Handler == "" && t.Name != c.Kafka.Topic {
+			return fmt.Errorf("kafka.topics[%d].handler is required", i)
+		}
+		switch t.OnError {
+		case "", "skip", "retry", "pause":
+		default:
+			return fmt.Errorf("kafka.topics[%d].on_error must be skip, retry or pause, got %q", i, t.OnError)
+		}
+		if t.Concurrency < 0 || t.MaxRetries < 0 || t.RetryBackoff < 0 {
+			return fmt.Errorf("kafka.topics[%d]: concurrency, max_retries and retry_backoff must not be negative", i)
+		}
+	}
+
+	if c.Kafka.MaxPollRecords < 1 {
+		return fmt.Errorf("kafka.max_poll_records must be positive, got %d", c.Kafka.MaxPollRecords)
+	}
+	if err := c.Kafka.Reader.validate(c.Kafka.Decoding); err != nil {
+		return err
+	}
+
+	if c.Inbox.Enabled {
+		if c.Inbox.Dir == "" {
+			return errors.New("inbox.dir is required when inbox is enabled")
+		}
+		if c.Inbox.PollInterval <= 0 {
+			return fmt.Errorf("inbox.poll_interval must be positive, got %s", c.Inbox.PollInterval)
+		}
+	}
+
+	// Без аутентификации любой, кто дотянулся до адреса, поставит консюмер на паузу
+	if c.Admin.Enabled && !c.Auth.Enabled {
+		return errors.New("admin.enabled requires auth.enabled")
+	}
+
+	if c.Consistency.ToleranceMinor < 0 {
+		return fmt.Errorf("consistency.tolerance_minor must not be negative, got %d", c.Consistency.ToleranceMinor)
+	}
+
+	if err := c.Kafka.Producer.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Kafka.TLS.validate(); err != nil {
+		return err
+	}
+	if err := c.Kafka.SASL.validate(); err != nil {
+		return err
+	}
+
+	decodings := map[string]Decoding{
+		"http_server.decoding": c.HTTPServer.Decoding,
+		"kafka.decoding":       c.Kafka.Decoding,
+	}
+	for name, d := range decodings {
+		switch d.Mode {
+		case "strict", "lenient", "logged":
+		default:
+			return fmt.Errorf("%s.mode must be strict, lenient or logged, got %q", name, d.Mode)
+		}
+		if d.MaxBytes <= 0 {
+			return fmt.Errorf("%s.max_bytes must be positive", name)
+		}
+	}
+
+	return nil
+}
+
+func (r KafkaReader) validate(decoding Decoding) error {
+	if r.MinBytes < 1 {
+		return fmt.Errorf("kafka.reader.min_bytes must be positive, got %d", r.MinBytes)
+	}
+	if r.MaxBytes < r.MinBytes {
+		return fmt.Errorf("kafka.reader.max_bytes (%d) must not be less than min_bytes (%d)", r.MaxBytes, r.MinBytes)
+	}
+	// Сообщение, которое декодер еще готов принять, должно помещаться в один fetch
+	if decoding.MaxBytes > 0 && int64(r.MaxBytes) < decoding.MaxBytes {
+		return fmt.Errorf("kafka.reader.max_bytes (%d) must not be less than kafka.decoding.max_bytes (%d)", r.MaxBytes, decoding.MaxBytes)
+	}
+
+	if r.MaxWait <= 0 {
+		return fmt.Errorf("kafka.reader.max_wait must be positive, got %s", r.MaxWait)
+	}
+	if r.CommitInterval < 0 {
+		return fmt.Errorf("kafka.reader.commit_interval must not be negative, got %s", r.CommitInterval)
+	}
+	if r.HeartbeatInterval <= 0 || r.SessionTimeout <= 0 || r.RebalanceTimeout <= 0 {
+		return errors.New("kafka.reader.heartbeat_interval, session_timeout and rebalance_timeout must be positive")
+	}
+	// Брокер исключает участника, не приславшего heartbeat за session_timeout
+	if r.HeartbeatInterval >= r.SessionTimeout {
+		return fmt.Errorf("kafka.reader.heartbeat_interval (%s) must be less than session_timeout (%s)", r.HeartbeatInterval, r.SessionTimeout)
+	}
+
+	switch r.IsolationLevel {
+	case "read_uncommitted", "read_committed":
+	default:
+		return fmt.Errorf("kafka.reader.isolation_level must be read_uncommitted or read_committed, got %q", r.IsolationLevel)
+	}
+
+	if len(r.PartitionAssignment) == 0 {
+		return errors.New("kafka.reader.partition_assignment must list at least one strategy")
+	}
+	seen := make(map[string]bool, len(r.PartitionAssignment))
+	for _, a := range r.PartitionAssignment {
+		switch a {
+		case AssignRange, AssignRoundRobin:
+		default:
+			return fmt.Errorf("kafka.reader.partition_assignment may only contain %s and %s, got %q", AssignRange, AssignRoundRobin, a)
+		}
+		if seen[a] {
+			return fmt.Errorf("kafka.reader.partition_assignment lists %s twice", a)
+		}
+		seen[a] = true
+	}
+
+	return nil
+}
+
+func (p KafkaProducer) validate() error {
+	if !slices.Contains(compressions, p.Compression) {
+		return fmt.Errorf("kafka.producer.compression must be one of %s, got %q", strings.Join(compressions, ", "), p.Compression)
+	}
+	if !slices.Contains(requiredAcks, p.RequiredAcks) {
+		return fmt.Errorf("kafka.producer.required_acks must be one of %s, got %q", strings.Join(requiredAcks, ", "), p.RequiredAcks)
+	}
+	if p.MaxAttempts < 1 || p.BatchSize < 1 {
+		return errors.New("kafka.producer.max_attempts and batch_size must be positive")
+	}
+	if p.BatchTimeout <= 0 || p.WriteTimeout <= 0 {
+		return errors.New("kafka.producer.batch_timeout and write_timeout must be positive")
+	}
+
+	return nil
+}
+
+func (t KafkaTLS) validate() error {
+	if !t.Enabled {
+		if t.CAFile != "" || t.CertFile != "" || t.KeyFile != "" || t.InsecureSkipVerify {
+			return errors.New("kafka.tls settings are set but kafka.tls.enabled is false")
+		}
+		return nil
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("kafka.tls.cert_file and kafka.tls.key_file must be set together")
+	}
+
+	return nil
+}
+
+func (s KafkaSASL) validate() error {
+	switch s.Mechanism {
+	case "":
+		return nil
+	case SASLPlain, SASLScramSHA256, SASLScramSHA512:
+	default:
+		return fmt.Errorf("kafka.sasl.mechanism must be %s, %s or %s, got %q", SASLPlain, SASLScramSHA256, SASLScramSHA512, s.Mechanism)
+	}
+
+	if s.Username == "" || s.Password == "" {
+		return fmt.Errorf("kafka.sasl.username and kafka.sasl.password are required for %s", s.Mechanism)
+	}
+
+	return nil
+}
+
+// Reload перечитывает конфиг из того же файла, из которого он был загружен
+func (c *Config) Reload() (*Config, error) {
+	if c.path == "" {
+		return nil, errors.New("config was not loaded from a file")
 	}
 
-	return &cfg
+	return LoadByPath(c.path)
 }
 
 // fetchConfigPath извлекает путь конфигурации из флага командной строки или переменной среды.
@@ -0,0 +1,201 @@
+package consistency
+
+import (
+	"L0/internal/config"
+	"L0/internal/lib/money"
+	"L0/internal/models"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Имена правил, они же значения config.Consistency.Rules и models.Warning.Rule
+const (
+	// RulePaymentAmount сверяет payment.amount с goods_total + delivery_cost + custom_fee
+	RulePaymentAmount = "payment_amount"
+	// RuleGoodsTotal сверяет payment.goods_total с суммой total_price товаров
+	RuleGoodsTotal = "goods_total"
+	// RuleItemTotalPrice сверяет total_price товара с ценой за вычетом скидки sale
+	RuleItemTotalPrice = "item_total_price"
+)
+
+// rule проверяет заказ и сообщает о расхождениях через check.mismatch
+type rule func(c *check, o models.Order)
+
+// rules перечисляет правила в порядке проверки. Новое правило добавляется сюда
+var rules = []struct {
+	name  string
+	check rule
+}{
+	{RulePaymentAmount, paymentAmount},
+	{RuleGoodsTotal, goodsTotal},
+	{RuleItemTotalPrice, itemTotalPrice},
+}
+
+// Rules возвращает имена всех правил в порядке проверки
+func Rules() []string {
+	names := make([]string, len(rules))
+	for i, r := range rules {
+		names[i] = r.name
+	}
+
+	return names
+}
+
+// Checker проверяет денежную согласованность заказа. Суммы сравниваются в валюте
+// заказа с допуском tolerance минорных единиц
+type Checker struct {
+	rules     []string
+	tolerance int64
+}
+
+// New создает проверку по настройкам конфига. Пустой список правил включает все
+func New(cfg config.Consistency) (*Checker, error) {
+	if cfg.ToleranceMinor < 0 {
+		return nil, fmt.Errorf("consistency tolerance must not be negative, got %d", cfg.ToleranceMinor)
+	}
+	// Валюта без минорной единицы дает наибольшую сумму допуска
+	if _, err := money.FromMinor(cfg.ToleranceMinor, money.Currency{Code: "XXX"}); err != nil {
+		return nil, fmt.Errorf("consistency tolerance is too large: %w", err)
+	}
+
+	known := Rules()
+	enabled := cfg.Rules
+	if len(enabled) == 0 {
+		enabled = known
+	}
+	for _, name := range enabled {
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("unknown consistency rule %q, known rules: %s", name, strings.Join(known, ", "))
+		}
+	}
+
+	return &Checker{rules: enabled, tolerance: cfg.ToleranceMinor}, nil
+}
+
+// Check возвращает нарушения правил в порядке их проверки. nil Checker ничего не проверяет
+func (c *Checker) Check(order models.Order) []models.Warning {
+	if c == nil {
+		return nil
+	}
+
+	// Допуск проверен в New для любой валюты, поэтому ошибки здесь нет
+	currency := money.CurrencyOf(order.Payment.Currency)
+	tolerance, _ := money.FromMinor(c.tolerance, currency)
+	chk := &check{
+		currency:  currency,
+		tolerance: tolerance,
+	}
+	for _, r := range rules {
+		if slices.Contains(c.rules, r.name) {
+			chk.rule = r.name
+			r.check(chk, order)
+		}
+	}
+
+	return chk.warnings
+}
+
+// Rules возвращает имена включенных правил в порядке проверки
+func (c *Checker) Rules() []string {
+	var names []string
+	for _, r := range rules {
+		if slices.Contains(c.rules, r.name) {
+			names = append(names, r.name)
+		}
+	}
+
+	return names
+}
+
+// check накапливает нарушения одной проверки заказа
+type check struct {
+	rule      string
+	currency  money.Currency
+	tolerance money.Amount
+	warnings  []models.Warning
+}
+
+// mismatch добавляет нарушение, если actual отличается от expected больше допуска
+func (c *check) mismatch(path string, actual, expected money.Amount, formula string) {
+	diff, err := actual.Sub(expected)
+	if err == nil && diff < 0 {
+		diff, err = money.Amount(0).Sub(diff)
+	}
+	if err != nil {
+		c.overflow(path, formula, err)
+		return
+	}
+	if diff <= c.tolerance {
+		return
+	}
+
+	c.warnings = append(c.warnings, models.Warning{
+		Rule: c.rule,
+		Path: path,
+		Message: fmt.Sprintf("%s is %s, expected %s (%s)",
+			path, actual.Format(c.currency), expected.Format(c.currency), formula),
+	})
+}
+
+// overflow добавляет нарушение для сумм, которые нельзя сверить без переполнения.
+// Такие суммы не пропускаются молча: переполнение могло бы подогнать итог под правило
+func (c *check) overflow(path, formula string, err error) {
+	c.warnings = append(c.warnings, models.Warning{
+		Rule:    c.rule,
+		Path:    path,
+		Message: fmt.Sprintf("%s cannot be checked against %s: %v", path, formula, err),
+	})
+}
+
+func paymentAmount(c *check, o models.Order) {
+	const formula = "goods_total + delivery_cost + custom_fee"
+
+	p := o.Payment
+	expected, err := money.Sum(p.GoodsTotal, p.DeliveryCost, p.CustomFee)
+	if err != nil {
+		c.overflow("payment.amount", formula, err)
+		return
+	}
+	c.mismatch("payment.amount", p.Amount, expected, formula)
+}
+
+// goodsTotal пропускает заказы без товаров: сверять итог не с чем
+func goodsTotal(c *check, o models.Order) {
+	const formula = "sum of items total_price"
+
+	if len(o.Items) == 0 {
+		return
+	}
+
+	totals := make([]money.Amount, len(o.Items))
+	for i, item := range o.Items {
+		totals[i] = item.TotalPrice
+	}
+	total, err := money.Sum(totals...)
+	if err != nil {
+		c.overflow("payment.goods_total", formula, err)
+		return
+	}
+	c.mismatch("payment.goods_total", o.Payment.GoodsTotal, total, formula)
+}
+
+// itemTotalPrice считает скидку с округлением до минорной единицы, как money.Amount.Discount.
+// Если price и total_price целые, продавец указывает цены в целых единицах валюты:
+// у price 453 со скидкой 30% total_price 317, а не 317.10. Такой total_price принимается,
+// только если он точно равен скидке, округленной до целых. Иначе он сверяется с точной
+// скидкой, чтобы округление до целых не расширяло допуск
+func itemTotalPrice(c *check, o models.Order) {
+	for i, item := range o.Items {
+		expected := item.Price.Discount(item.Sale, c.currency)
+
+		_, wholePrice := item.Price.Whole()
+		_, wholeTotal := item.TotalPrice.Whole()
+		if wholePrice && wholeTotal && item.TotalPrice == item.Price.Discount(item.Sale, money.Currency{Code: c.currency.Code}) {
+			continue
+		}
+
+		c.mismatch(fmt.Sprintf("items[%d].total_price", i), item.TotalPrice, expected,
+			fmt.Sprintf("price with %d%% sale", item.Sale))
+	}
+}
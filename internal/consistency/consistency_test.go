@@ -0,0 +1,165 @@
+package consistency
+
+import (
+	"L0/internal/config"
+	"L0/internal/lib/money"
+	"L0/internal/models"
+	"math"
+	"strings"
+	"testing"
+)
+
+// unit является одной единицей валюты
+const unit = money.Amount(1e4)
+
+// sampleOrder повторяет суммы образца заказа Wildberries: товар за 453 со скидкой 30%
+func sampleOrder(currency string, price, totalPrice money.Amount) models.Order {
+	return models.Order{
+		OrderUID: "b563feb7b2b84b6test",
+		Payment: models.Payment{
+			Currency:     currency,
+			Amount:       totalPrice + 1500*unit,
+			DeliveryCost: 1500 * unit,
+			GoodsTotal:   totalPrice,
+		},
+		Items: []models.Item{{Price: price, Sale: 30, TotalPrice: totalPrice}},
+	}
+}
+
+func TestItemTotalPrice(t *testing.T) {
+	checker, err := New(config.Consistency{Rules: []string{RuleItemTotalPrice}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		currency   string
+		price      money.Amount
+		totalPrice money.Amount
+		warn       bool
+	}{
+		{"whole units are rounded to whole units", "RUB", 453 * unit, 317 * unit, false},
+		{"whole units off by one unit", "RUB", 453 * unit, 318 * unit, true},
+		{"whole units off by one unit below", "RUB", 453 * unit, 316 * unit, true},
+		{"whole units rounded half away from zero", "RUB", 455 * unit, 319 * unit, false},
+		{"whole units rounded the other way", "RUB", 455 * unit, 318 * unit, true},
+		{"fractional total is rounded to kopecks", "RUB", 453 * unit, 3171 * unit / 10, false},
+		{"fractional total off by kopecks", "RUB", 453 * unit, 3175 * unit / 10, true},
+		{"fractional price", "USD", 4535 * unit / 10, 31745 * unit / 100, false},
+		{"currency without minor units", "JPY", 453 * unit, 317 * unit, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := checker.Check(sampleOrder(tt.currency, tt.price, tt.totalPrice))
+			if got := len(warnings) > 0; got != tt.warn {
+				t.Fatalf("warnings = %v, want warning %t", warnings, tt.warn)
+			}
+			if tt.warn && warnings[0].Path != "items[0].total_price" {
+				t.Errorf("warning path = %s, want items[0].total_price", warnings[0].Path)
+			}
+		})
+	}
+}
+
+// TestItemTotalPriceTolerance проверяет, что округление до целых не складывается с допуском:
+// 316 отличается от округленных 317 на единицу, но от точных 317.10 больше чем на единицу
+func TestItemTotalPriceTolerance(t *testing.T) {
+	checker, err := New(config.Consistency{Rules: []string{RuleItemTotalPrice}, ToleranceMinor: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		totalPrice money.Amount
+		warn       bool
+	}{
+		{317 * unit, false},
+		{318 * unit, false},
+		{316 * unit, true},
+		{319 * unit, true},
+	}
+
+	for _, tt := range tests {
+		warnings := checker.Check(sampleOrder("RUB", 453*unit, tt.totalPrice))
+		if got := len(warnings) > 0; got != tt.warn {
+			t.Errorf("total_price %s: warnings = %v, want warning %t", tt.totalPrice, warnings, tt.warn)
+		}
+	}
+}
+
+// TestSampleOrder проверяет, что образец заказа проходит все правила с нулевым допуском
+func TestSampleOrder(t *testing.T) {
+	checker, err := New(config.Consistency{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if warnings := checker.Check(sampleOrder("RUB", 453*unit, 317*unit)); len(warnings) != 0 {
+		t.Errorf("sample order has warnings: %v", warnings)
+	}
+}
+
+// TestOverflow проверяет, что переполнение при сверке сумм сообщается нарушением,
+// а не подгоняет итог под правило
+func TestOverflow(t *testing.T) {
+	checker, err := New(config.Consistency{Rules: []string{RulePaymentAmount, RuleGoodsTotal}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	half := money.Amount(math.MaxInt64/2 + 1)
+	tests := []struct {
+		name  string
+		order func(o *models.Order)
+		path  string
+	}{
+		{
+			// Без проверки два товара дают в сумме MinInt64, как и goods_total
+			name: "items total wraps",
+			order: func(o *models.Order) {
+				o.Items = []models.Item{{TotalPrice: half}, {TotalPrice: half}}
+				o.Payment.GoodsTotal = math.MinInt64
+				o.Payment.Amount = math.MinInt64
+				o.Payment.DeliveryCost = 0
+			},
+			path: "payment.goods_total",
+		},
+		{
+			name: "payment sum wraps",
+			order: func(o *models.Order) {
+				o.Payment.GoodsTotal = half
+				o.Payment.DeliveryCost = half
+				o.Payment.Amount = math.MinInt64
+				o.Items = nil
+			},
+			path: "payment.amount",
+		},
+		{
+			name: "difference wraps",
+			order: func(o *models.Order) {
+				o.Payment.Amount = math.MinInt64
+				o.Payment.GoodsTotal = math.MaxInt64
+				o.Payment.DeliveryCost = 0
+				o.Items = nil
+			},
+			path: "payment.amount",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := sampleOrder("RUB", 453*unit, 317*unit)
+			tt.order(&order)
+
+			warnings := checker.Check(order)
+			for _, w := range warnings {
+				if w.Path == tt.path && strings.Contains(w.Message, "out of range") {
+					return
+				}
+			}
+			t.Fatalf("warnings = %v, want overflow at %s", warnings, tt.path)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package conditional
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+// cacheControl заставляет клиента каждый раз перепроверять ответ по ETag
+const cacheControl = "private, no-cache"
+
+// ETag считает сильный ETag по JSON представлению значения
+func ETag(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+// SetHeaders выставляет ETag, Last-Modified и Cache-Control одинаково для всех ответов
+func SetHeaders(w http.ResponseWriter, etag string, lastModified time.Time) {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", cacheControl)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// NotModified проверяет If-None-Match, а при его отсутствии If-Modified-Since.
+// Если ресурс не изменился, пишет 304 и возвращает true
+func NotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		matched, ok := match(inm, etag, true)
+		if !ok {
+			return false
+		}
+		// 304 не сжимается, поэтому ETag сжатого представления возвращается как прислан
+		if matched != "*" {
+			w.Header().Set("ETag", matched)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || lastModified.IsZero() {
+		return false
+	}
+
+	t, err := http.ParseTime(ims)
+	if err != nil || lastModified.Truncate(time.Second).After(t) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// IfMatch проверяет If-Match для изменяющих запросов, чтобы не потерять чужие обновления.
+// Если предусловие не выполнено, пишет 412 и возвращает false
+func IfMatch(w http.ResponseWriter, r *http.Request, etag string) bool {
+	im := r.Header.Get("If-Match")
+	if _, ok := match(im, etag, false); im == "" || ok {
+		return true
+	}
+
+	render.Status(r, http.StatusPreconditionFailed)
+	render.JSON(w, r, map[string]string{"error": "resource has been modified"})
+	return false
+}
+
+// match ищет ETag в списке из заголовка и возвращает совпавший кандидат. If-None-Match
+// использует слабое сравнение, If-Match сильное. Суффикс content-coding, который
+// добавляет Encoded, при сравнении отбрасывается
+func match(header, etag string, weak bool) (string, bool) {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return candidate, true
+		}
+		tag := candidate
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		} else if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		if tag == etag || withoutCoding(tag) == etag {
+			return tag, true
+		}
+	}
+
+	return "", false
+}
+
+// codings перечисляет content-coding, которыми может быть сжат ответ
+var codings = []string{"gzip", "deflate", "zstd", "br"}
+
+// withCoding добавляет content-coding к сильному ETag: "abc" становится "abc-gzip"
+func withCoding(etag, coding string) string {
+	if strings.HasPrefix(etag, "W/") || len(etag) < 2 {
+		return etag
+	}
+
+	return etag[:len(etag)-1] + "-" + coding + `"`
+}
+
+func withoutCoding(etag string) string {
+	for _, coding := range codings {
+		if trimmed, ok := strings.CutSuffix(etag, "-"+coding+`"`); ok {
+			return trimmed + `"`
+		}
+	}
+
+	return etag
+}
+
+// Encoded добавляет к ETag content-coding ответа. Сжатые и несжатые байты
+// не могут делить один сильный ETag, поэтому Encoded ставится перед middleware сжатия
+func Encoded(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&encodedWriter{ResponseWriter: w}, r)
+	})
+}
+
+// encodedWriter правит ETag в момент записи статуса, когда Content-Encoding уже выставлен
+type encodedWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (ew *encodedWriter) WriteHeader(code int) {
+	if !ew.wroteHeader {
+		ew.wroteHeader = true
+		h := ew.Header()
+		if coding := h.Get("Content-Encoding"); coding != "" && coding != "identity" {
+			if etag := h.Get("ETag"); etag != "" {
+				h.Set("ETag", withCoding(etag, coding))
+			}
+		}
+	}
+
+	ew.ResponseWriter.WriteHeader(code)
+}
+
+func (ew *encodedWriter) Write(p []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+
+	return ew.ResponseWriter.Write(p)
+}
+
+func (ew *encodedWriter) Flush() {
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (ew *encodedWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
@@ -0,0 +1,128 @@
+package conditional
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+const etag = `"abc"`
+
+func TestIfMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		ok     bool
+	}{
+		{"no header", "", true},
+		{"same tag", `"abc"`, true},
+		{"any", "*", true},
+		{"list", `"xyz", "abc"`, true},
+		{"coded tag", `"abc-gzip"`, true},
+		{"weak tag", `W/"abc"`, false},
+		{"mismatch", `"xyz"`, false},
+		{"list mismatch", `"xyz", W/"abc"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+			rec := httptest.NewRecorder()
+
+			if ok := IfMatch(rec, r, etag); ok != tt.ok {
+				t.Fatalf("IfMatch = %t, want %t", ok, tt.ok)
+			}
+			if !tt.ok && rec.Code != http.StatusPreconditionFailed {
+				t.Errorf("status = %d, want 412", rec.Code)
+			}
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		ok     bool
+		etag   string
+	}{
+		{"same tag", `"abc"`, true, `"abc"`},
+		{"any", "*", true, ""},
+		{"weak tag", `W/"abc"`, true, `"abc"`},
+		{"list", `"xyz", W/"abc"`, true, `"abc"`},
+		{"coded tag", `"abc-zstd"`, true, `"abc-zstd"`},
+		{"other coding of other tag", `"xyz-gzip"`, false, ""},
+		{"mismatch", `"xyz"`, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("If-None-Match", tt.header)
+			rec := httptest.NewRecorder()
+
+			if ok := NotModified(rec, r, etag, time.Time{}); ok != tt.ok {
+				t.Fatalf("NotModified = %t, want %t", ok, tt.ok)
+			}
+			if tt.ok && rec.Code != http.StatusNotModified {
+				t.Errorf("status = %d, want 304", rec.Code)
+			}
+			if got := rec.Header().Get("ETag"); got != tt.etag {
+				t.Errorf("ETag = %s, want %s", got, tt.etag)
+			}
+		})
+	}
+}
+
+// TestEncoded проверяет, что у сжатого и несжатого ответа разные ETag
+func TestEncoded(t *testing.T) {
+	h := Encoded(middleware.Compress(5, "application/json")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if NotModified(w, r, etag, time.Time{}) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		SetHeaders(w, etag, time.Time{})
+		_, _ = w.Write([]byte(`{"order_uid": "` + strings.Repeat("x", 100) + `"}`))
+	})))
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		ifNoneMatch    string
+		code           int
+		etag           string
+	}{
+		{"identity", "", "", http.StatusOK, `"abc"`},
+		{"gzip", "gzip", "", http.StatusOK, `"abc-gzip"`},
+		{"revalidate gzip", "gzip", `"abc-gzip"`, http.StatusNotModified, `"abc-gzip"`},
+		{"revalidate identity", "", `"abc"`, http.StatusNotModified, `"abc"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			if tt.ifNoneMatch != "" {
+				r.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.code {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.code)
+			}
+			if got := rec.Header().Get("ETag"); got != tt.etag {
+				t.Errorf("ETag = %s, want %s", got, tt.etag)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"L0/internal/kafka/consumer"
+	"net/http"
+
+	"github.com/go-chi/render"
+)
+
+// Consumer управляет чтением из Kafka, реализуется consumer.Consumer
+type Consumer interface {
+	Pause()
+	Resume()
+	Stats() consumer.Stats
+}
+
+type ConsumerHandler struct {
+	consumer Consumer
+}
+
+// NewConsumerHandler создает хендлер управления консюмером
+func NewConsumerHandler(c Consumer) *ConsumerHandler {
+	return &ConsumerHandler{consumer: c}
+}
+
+// Stats отдает состояние консюмера, смещения и лаг по партициям
+func (h *ConsumerHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, h.consumer.Stats())
+}
+
+// Pause приостанавливает чтение из Kafka и отдает новое состояние
+func (h *ConsumerHandler) Pause(w http.ResponseWriter, r *http.Request) {
+	h.consumer.Pause()
+	render.JSON(w, r, h.consumer.Stats())
+}
+
+// Resume возобновляет чтение из Kafka и отдает новое состояние
+func (h *ConsumerHandler) Resume(w http.ResponseWriter, r *http.Request) {
+	h.consumer.Resume()
+	render.JSON(w, r, h.consumer.Stats())
+}
@@ -0,0 +1,326 @@
+package admin
+
+import (
+	"L0/internal/http-server/conditional"
+	"L0/internal/kafka/codec"
+	"L0/internal/kafka/headers"
+	"L0/internal/lib/audit"
+	"L0/internal/models"
+	"L0/internal/service"
+	"L0/internal/storage/postgres"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+// QuarantineStore хранит сообщения карантина, реализуется postgres.Storage
+type QuarantineStore interface {
+	ListQuarantined(ctx context.Context, filter postgres.QuarantineFilter) ([]models.QuarantinedMessage, error)
+	GetQuarantined(ctx context.Context, id int64) (*models.QuarantinedMessage, error)
+	UpdateQuarantinedPayload(ctx context.Context, id int64, payload []byte, contentType string) error
+	MarkResubmitted(ctx context.Context, id int64) error
+}
+
+// OrderSaver сохраняет заказ обычным путем с валидацией и кэшем, реализуется service.OrderService
+type OrderSaver interface {
+	SaveOrder(ctx context.Context, order *models.Order) error
+}
+
+// sourceQuarantine помечает заказы, повторно отправленные из карантина без source-system
+const sourceQuarantine = "quarantine"
+
+// maxListLimit ограничивает размер страницы списка карантина
+const maxListLimit = 1000
+
+type QuarantineHandler struct {
+	store    QuarantineStore
+	orders   OrderSaver
+	codecs   *codec.Registry
+	maxBytes int64
+	log      *slog.Logger
+}
+
+// NewQuarantineHandler создает хендлер карантина. maxBytes ограничивает размер
+// исправленного тела так же, как размер сообщений в консюмере
+func NewQuarantineHandler(store QuarantineStore, orders OrderSaver, codecs *codec.Registry, maxBytes int64, log *slog.Logger) *QuarantineHandler {
+	return &QuarantineHandler{
+		store:    store,
+		orders:   orders,
+		codecs:   codecs,
+		maxBytes: maxBytes,
+		log:      log.With(slog.String("component", "handler/quarantine")),
+	}
+}
+
+// quarantinedView показывает тело текстом, если это UTF-8, иначе в base64
+type quarantinedView struct {
+	models.QuarantinedMessage
+	Payload       string `json:"payload,omitempty"`
+	PayloadBase64 []byte `json:"payload_base64,omitempty"`
+	PayloadSize   int    `json:"payload_size"`
+}
+
+func viewOf(m models.QuarantinedMessage, withPayload bool) quarantinedView {
+	v := quarantinedView{QuarantinedMessage: m, PayloadSize: len(m.Payload)}
+	if !withPayload {
+		return v
+	}
+
+	if utf8.Valid(m.Payload) {
+		v.Payload = string(m.Payload)
+	} else {
+		v.PayloadBase64 = m.Payload
+	}
+
+	return v
+}
+
+// List отдает страницу карантина без тел сообщений. Фильтры: status, error_class,
+// topic, after_id и limit
+func (h *QuarantineHandler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := postgres.QuarantineFilter{
+		Status:     q.Get("status"),
+		ErrorClass: q.Get("error_class"),
+		Topic:      q.Get("topic"),
+	}
+
+	if s := q.Get("after_id"); s != "" {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id < 0 {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]string{"error": "after_id must be a non-negative integer"})
+			return
+		}
+		filter.AfterID = id
+	}
+	if s := q.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]string{"error": "limit must be between 1 and " + strconv.Itoa(maxListLimit)})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	messages, err := h.store.ListQuarantined(r.Context(), filter)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	views := make([]quarantinedView, 0, len(messages))
+	for _, m := range messages {
+		views = append(views, viewOf(m, false))
+	}
+
+	render.JSON(w, r, views)
+}
+
+// Get отдает сообщение карантина вместе с телом и ETag для If-Match при правке тела
+func (h *QuarantineHandler) Get(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	view := viewOf(*m, true)
+	etag, err := conditional.ETag(view)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	conditional.SetHeaders(w, etag, time.Time{})
+	if conditional.NotModified(w, r, etag, time.Time{}) {
+		return
+	}
+
+	render.JSON(w, r, view)
+}
+
+// UpdatePayload заменяет тело сообщения телом запроса. Content-Type запроса, если
+// он задан, становится форматом сообщения. С If-Match тело меняется, только если
+// сообщение не изменилось с тех пор, как его прочитали
+func (h *QuarantineHandler) UpdatePayload(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	etag, err := conditional.ETag(viewOf(*m, true))
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+	if !conditional.IfMatch(w, r, etag) {
+		return
+	}
+
+	if m.Status == models.QuarantineStatusResubmitted {
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]string{"error": "message is already resubmitted"})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			render.Status(r, http.StatusRequestEntityTooLarge)
+			render.JSON(w, r, map[string]string{"error": "payload exceeds size limit"})
+			return
+		}
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "failed to read payload"})
+		return
+	}
+	if len(body) == 0 {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "payload is required"})
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType != "" {
+		if _, err := h.codecs.Lookup(contentType); err != nil {
+			render.Status(r, http.StatusUnsupportedMediaType)
+			render.JSON(w, r, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := h.store.UpdateQuarantinedPayload(r.Context(), m.ID, body, contentType); err != nil {
+		h.renderStoreError(w, r, err)
+		return
+	}
+
+	h.log.Info("quarantined payload edited",
+		slog.Int64("id", m.ID),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	h.Get(w, r)
+}
+
+// Resubmit декодирует тело сообщения и сохраняет заказ через OrderService.SaveOrder.
+// Повторно отправить можно только сообщения order.created
+func (h *QuarantineHandler) Resubmit(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+	if m.Status == models.QuarantineStatusResubmitted {
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]string{"error": "message is already resubmitted"})
+		return
+	}
+	if m.EventType != headers.EventOrderCreated {
+		render.Status(r, http.StatusConflict)
+		render.JSON(w, r, map[string]string{"error": "only " + headers.EventOrderCreated + " messages can be resubmitted"})
+		return
+	}
+
+	dec, err := h.codecs.Lookup(m.ContentType)
+	if err != nil {
+		render.Status(r, http.StatusUnprocessableEntity)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	order, err := dec.Decode(m.Payload, m.SchemaVersion)
+	if err != nil {
+		render.Status(r, http.StatusUnprocessableEntity)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := h.orders.SaveOrder(resubmitContext(r, m), &order); err != nil {
+		var validationErr *models.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			render.Status(r, http.StatusUnprocessableEntity)
+			render.JSON(w, r, map[string]any{"error": "invalid order", "reasons": validationErr.Reasons})
+			return
+		case errors.Is(err, service.ErrOrderExists):
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]string{"error": err.Error()})
+			return
+		}
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := h.store.MarkResubmitted(r.Context(), m.ID); err != nil {
+		// Заказ уже сохранен, повторная отправка вернет 409, так что просто сообщаем об ошибке
+		h.renderStoreError(w, r, err)
+		return
+	}
+
+	h.log.Info("quarantined message resubmitted",
+		slog.Int64("id", m.ID),
+		slog.String("order_uid", order.OrderUID),
+		slog.String("request_id", middleware.GetReqID(r.Context())),
+	)
+
+	render.JSON(w, r, map[string]string{"order_uid": order.OrderUID, "status": models.QuarantineStatusResubmitted})
+}
+
+// resubmitContext сохраняет trace ID и источник исходного сообщения, если они были
+func resubmitContext(r *http.Request, m *models.QuarantinedMessage) context.Context {
+	info := audit.Info{
+		TraceID:      m.Headers[headers.TraceID],
+		SourceSystem: m.Headers[headers.SourceSystem],
+	}
+	if info.TraceID == "" {
+		info.TraceID = middleware.GetReqID(r.Context())
+	}
+	if info.SourceSystem == "" {
+		info.SourceSystem = sourceQuarantine
+	}
+
+	return audit.WithInfo(r.Context(), info)
+}
+
+// load читает сообщение по {id} из пути и сам отвечает ошибкой, если не вышло
+func (h *QuarantineHandler) load(w http.ResponseWriter, r *http.Request) (*models.QuarantinedMessage, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "id must be a positive integer"})
+		return nil, false
+	}
+
+	m, err := h.store.GetQuarantined(r.Context(), id)
+	if err != nil {
+		h.renderStoreError(w, r, err)
+		return nil, false
+	}
+
+	return m, true
+}
+
+func (h *QuarantineHandler) renderStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, postgres.ErrQuarantinedNotFound) {
+		render.Status(r, http.StatusNotFound)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	render.Status(r, http.StatusInternalServerError)
+	render.JSON(w, r, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"L0/internal/config"
+	"L0/internal/lib/orderenc"
+	"L0/internal/lib/strictjson"
+	"L0/internal/models"
+	"L0/internal/service"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/render"
+)
+
+const (
+	StatusCreated   = "created"
+	StatusDuplicate = "duplicate"
+	StatusInvalid   = "invalid"
+	StatusFailed    = "failed"
+)
+
+type BatchHandler struct {
+	service  *service.OrderService
+	decoding config.Decoding
+	cfg      config.Batch
+	log      *slog.Logger
+}
+
+// BatchResult описывает итог обработки одного заказа из пакета
+type BatchResult struct {
+	Index    int      `json:"index"`
+	OrderUID string   `json:"order_uid,omitempty"`
+	Status   string   `json:"status"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+type BatchResponse struct {
+	Summary map[string]int `json:"summary"`
+	Results []BatchResult  `json:"results"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// NewBatchHandler создает хендлер пакетной загрузки заказов. Каждый заказ пакета
+// разбирается по decoding так же, как тело CreateOrder
+func NewBatchHandler(s *service.OrderService, decoding config.Decoding, cfg config.Batch, log *slog.Logger) *BatchHandler {
+	return &BatchHandler{
+		service:  s,
+		decoding: decoding,
+		cfg:      cfg,
+		log:      log.With(slog.String("component", "handler/batch")),
+	}
+}
+
+// CreateOrders принимает JSON массив или NDJSON поток заказов и сохраняет каждый независимо.
+// Если чтение пакета прервано после сохранения части заказов, ответ 207 содержит
+// результаты по уже обработанным заказам и причину в error
+func (h *BatchHandler) CreateOrders(w http.ResponseWriter, r *http.Request) {
+	// Большой пакет не должен упираться в общие таймауты сервера
+	rc := http.NewResponseController(w)
+	deadline := time.Now().Add(h.cfg.Timeout)
+	_ = rc.SetReadDeadline(deadline)
+	_ = rc.SetWriteDeadline(deadline)
+
+	ctx := auditContext(r)
+	log := h.log.With(slog.String("request_id", middleware.GetReqID(r.Context())))
+	body := http.MaxBytesReader(w, r.Body, h.cfg.MaxBytes)
+	dec := orderenc.NewDecoder(body)
+
+	resp := BatchResponse{
+		Summary: map[string]int{StatusCreated: 0, StatusDuplicate: 0, StatusInvalid: 0, StatusFailed: 0},
+		Results: []BatchResult{},
+	}
+
+	for i := 0; ; i++ {
+		raw, err := dec.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			status := http.StatusBadRequest
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			resp.Error = err.Error()
+			renderAborted(w, r, status, resp)
+			return
+		}
+
+		if i >= h.cfg.MaxOrders {
+			resp.Error = "too many orders in batch"
+			renderAborted(w, r, http.StatusRequestEntityTooLarge, resp)
+			return
+		}
+
+		result := h.saveOne(ctx, log, i, raw)
+		resp.Summary[result.Status]++
+		resp.Results = append(resp.Results, result)
+	}
+
+	render.JSON(w, r, resp)
+}
+
+// renderAborted отвечает на прерванный пакет. Пока ни один заказ не обработан, пакет
+// отклоняется целиком со status, иначе 207 сообщает, какие заказы уже сохранены
+func renderAborted(w http.ResponseWriter, r *http.Request, status int, resp BatchResponse) {
+	if len(resp.Results) > 0 {
+		status = http.StatusMultiStatus
+	}
+	render.Status(r, status)
+	render.JSON(w, r, resp)
+}
+
+func (h *BatchHandler) saveOne(ctx context.Context, log *slog.Logger, index int, raw json.RawMessage) BatchResult {
+	result := BatchResult{Index: index}
+
+	if int64(len(raw)) > h.decoding.MaxBytes {
+		result.Status = StatusInvalid
+		result.Errors = []string{fmt.Sprintf("order is larger than %d bytes", h.decoding.MaxBytes)}
+		return result
+	}
+
+	var order models.Order
+	problems, err := strictjson.Unmarshal(raw, &order, h.decoding.Mode)
+	if err != nil {
+		result.Status = StatusInvalid
+		var jsonErr *strictjson.Error
+		if errors.As(err, &jsonErr) {
+			result.Errors = jsonErr.Problems
+		} else {
+			result.Errors = []string{err.Error()}
+		}
+		return result
+	}
+	result.OrderUID = order.OrderUID
+	if len(problems) > 0 {
+		log.Warn("accepted order with unexpected JSON",
+			slog.Int("index", index),
+			slog.String("order_uid", order.OrderUID),
+			slog.Any("problems", problems),
+		)
+	}
+
+	err = h.service.SaveOrder(ctx, &order)
+
+	var validationErr *models.ValidationError
+	switch {
+	case err == nil:
+		result.Status = StatusCreated
+	case errors.As(err, &validationErr):
+		result.Status = StatusInvalid
+		result.Errors = validationErr.Reasons
+	case errors.Is(err, service.ErrOrderExists):
+		result.Status = StatusDuplicate
+	default:
+		result.Status = StatusFailed
+		result.Errors = []string{err.Error()}
+	}
+
+	return result
+}
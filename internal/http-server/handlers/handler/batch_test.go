@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"L0/internal/cache"
+	"L0/internal/config"
+	"L0/internal/consistency"
+	"L0/internal/lib/logger/handlers/slogdiscard"
+	"L0/internal/lib/strictjson"
+	"L0/internal/models"
+	"L0/internal/service"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newBatchHandler собирает хендлер пакета поверх хранилища в памяти
+func newBatchHandler(t *testing.T, decoding config.Decoding) (http.Handler, *memStorage) {
+	t.Helper()
+
+	checker, err := consistency.New(config.Consistency{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &memStorage{orders: map[string]models.Order{}}
+	svc := service.New(storage, cache.New(), checker)
+	batch := config.Batch{MaxBytes: 1 << 20, MaxOrders: 3, Timeout: time.Minute}
+
+	return http.HandlerFunc(NewBatchHandler(svc, decoding, batch, slogdiscard.NewDiscardLogger()).CreateOrders), storage
+}
+
+func postBatch(t *testing.T, h http.Handler, body string) (int, BatchResponse) {
+	t.Helper()
+
+	rec := serve(h, http.MethodPost, "/api/orders:batch", map[string]string{"Content-Type": "application/x-ndjson"}, body)
+	var resp BatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to decode response %s: %v", rec.Body, err)
+	}
+
+	return rec.Code, resp
+}
+
+// withField добавляет в заказ поле верхнего уровня, которого нет в models.Order
+func withField(order, field string) string {
+	return strings.Replace(compact(order), "{", "{"+field+",", 1)
+}
+
+func TestBatchDecodingMode(t *testing.T) {
+	body := strings.Join([]string{
+		compact(testOrderJSON("known")),
+		withField(testOrderJSON("unknown"), `"gift_wrap": true`),
+	}, "\n")
+
+	tests := []struct {
+		mode     string
+		statuses []string
+	}{
+		{strictjson.ModeStrict, []string{StatusCreated, StatusInvalid}},
+		{strictjson.ModeLenient, []string{StatusCreated, StatusCreated}},
+		{strictjson.ModeLogged, []string{StatusCreated, StatusCreated}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			h, _ := newBatchHandler(t, config.Decoding{Mode: tt.mode, MaxBytes: 1 << 20})
+
+			code, resp := postBatch(t, h, body)
+			if code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", code)
+			}
+			var statuses []string
+			for _, r := range resp.Results {
+				statuses = append(statuses, r.Status)
+			}
+			if !slices.Equal(statuses, tt.statuses) {
+				t.Fatalf("statuses = %v, want %v", statuses, tt.statuses)
+			}
+			if tt.mode == strictjson.ModeStrict {
+				if errs := resp.Results[1].Errors; len(errs) != 1 || !strings.Contains(errs[0], "gift_wrap") {
+					t.Errorf("errors = %v, want the path of the unknown field", errs)
+				}
+			}
+		})
+	}
+}
+
+func TestBatchOrderMaxBytes(t *testing.T) {
+	small := compact(testOrderJSON("small"))
+	large := withField(testOrderJSON("large"), `"comment": "`+strings.Repeat("x", len(small))+`"`)
+	h, storage := newBatchHandler(t, config.Decoding{Mode: strictjson.ModeLenient, MaxBytes: int64(len(small))})
+
+	code, resp := postBatch(t, h, small+"\n"+large)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if resp.Results[0].Status != StatusCreated || resp.Results[1].Status != StatusInvalid {
+		t.Fatalf("results = %+v, want created and invalid", resp.Results)
+	}
+	if errs := resp.Results[1].Errors; len(errs) != 1 || !strings.Contains(errs[0], "larger than") {
+		t.Errorf("errors = %v, want the size limit", errs)
+	}
+	if _, ok := storage.orders["large"]; ok {
+		t.Error("order over decoding.max_bytes was saved")
+	}
+}
+
+// TestBatchAbortedAfterSave проверяет, что прерванный пакет сообщает об уже сохраненных заказах
+func TestBatchAbortedAfterSave(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		saved []string
+	}{
+		{
+			name: "too many orders",
+			body: strings.Join([]string{
+				compact(testOrderJSON("a")), compact(testOrderJSON("b")), compact(testOrderJSON("c")), compact(testOrderJSON("d")),
+			}, "\n"),
+			saved: []string{"a", "b", "c"},
+		},
+		{
+			name:  "syntax error",
+			body:  compact(testOrderJSON("a")) + "\n" + `{"order_uid": `,
+			saved: []string{"a"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, storage := newBatchHandler(t, config.Decoding{Mode: strictjson.ModeStrict, MaxBytes: 1 << 20})
+
+			code, resp := postBatch(t, h, tt.body)
+			if code != http.StatusMultiStatus {
+				t.Fatalf("status = %d, want 207", code)
+			}
+			if resp.Error == "" {
+				t.Error("response has no error")
+			}
+			if len(resp.Results) != len(tt.saved) || resp.Summary[StatusCreated] != len(tt.saved) {
+				t.Fatalf("results = %+v, want %d created", resp.Results, len(tt.saved))
+			}
+			for _, uid := range tt.saved {
+				if _, ok := storage.orders[uid]; !ok {
+					t.Errorf("order %s is not saved", uid)
+				}
+			}
+		})
+	}
+}
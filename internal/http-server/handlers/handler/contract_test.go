@@ -0,0 +1,375 @@
+package handler
+
+import (
+	"L0/internal/cache"
+	"L0/internal/config"
+	"L0/internal/consistency"
+	"L0/internal/http-server/handlers/openapi"
+	"L0/internal/lib/logger/handlers/slogdiscard"
+	"L0/internal/lib/orderenc"
+	"L0/internal/lib/strictjson"
+	"L0/internal/models"
+	"L0/internal/service"
+	"L0/internal/storage/postgres"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func init() {
+	// CSV и NDJSON описаны в спецификации строками, строки NDJSON дополнительно
+	// сверяются со схемой Order в validateResponse
+	openapi3filter.RegisterBodyDecoder(orderenc.ContentTypeCSV, stringBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(orderenc.ContentTypeNDJSON, stringBodyDecoder)
+}
+
+func stringBodyDecoder(body io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (interface{}, error) {
+	b, err := io.ReadAll(body)
+	return string(b), err
+}
+
+// memStorage хранит заказы в памяти вместо PostgreSQL
+type memStorage struct {
+	mu     sync.Mutex
+	orders map[string]models.Order
+}
+
+func (m *memStorage) SaveOrder(_ context.Context, order models.Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.orders[order.OrderUID]; ok {
+		return postgres.ErrOrderExists
+	}
+	m.orders[order.OrderUID] = order
+	return nil
+}
+
+func (m *memStorage) SaveOrders(ctx context.Context, orders []models.Order) []error {
+	errs := make([]error, len(orders))
+	for i, order := range orders {
+		errs[i] = m.SaveOrder(ctx, order)
+	}
+	return errs
+}
+
+func (m *memStorage) GetOrder(orderUID string) (*models.Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	order, ok := m.orders[orderUID]
+	if !ok {
+		return nil, fmt.Errorf("order %s not found", orderUID)
+	}
+	return &order, nil
+}
+
+func (m *memStorage) GetAllOrders() ([]models.Order, error) {
+	return nil, nil
+}
+
+func (m *memStorage) ApplyEvent(context.Context, models.OrderEvent) (string, error) {
+	return "", nil
+}
+
+// testOrderJSON возвращает валидный заказ в JSON
+func testOrderJSON(uid string) string {
+	return fmt.Sprintf(`{
+		"order_uid": %[1]q,
+		"track_number": "WBILMTESTTRACK",
+		"entry": "WBIL",
+		"delivery": {"name": "Test Testov", "phone": "+9720000000", "zip": "2639809", "city": "Kiryat Mozkin",
+			"address": "Ploshad Mira 15", "region": "Kraiot", "email": "test@gmail.com"},
+		"payment": {"transaction": %[1]q, "request_id": "", "currency": "USD", "provider": "wbpay",
+			"amount": 1817.5, "payment_dt": 1637907727, "bank": "alpha", "delivery_cost": 1500,
+			"goods_total": 317.5, "custom_fee": 0},
+		"items": [{"chrt_id": 9934930, "track_number": "WBILMTESTTRACK", "price": 453, "rid": "ab4219087a764ae0btest",
+			"name": "Mascaras", "sale": 30, "size": "0", "total_price": 317.5, "nm_id": 2389212,
+			"brand": "Vivienne Sabo", "status": 202}],
+		"locale": "en",
+		"internal_signature": "",
+		"customer_id": "test",
+		"delivery_service": "meest",
+		"shardkey": "9",
+		"sm_id": 99,
+		"date_created": "2021-11-26T06:22:19Z",
+		"oof_shard": "1"
+	}`, uid)
+}
+
+// newTestRouter собирает маршруты API так же, как cmd/main, но без авторизации и лимитов
+func newTestRouter(t *testing.T) http.Handler {
+	t.Helper()
+
+	// Цена тестового заказа со скидкой расходится с total_price, поэтому в ответах есть warnings
+	checker, err := consistency.New(config.Consistency{})
+	if err != nil {
+		t.Fatalf("failed to init consistency checker: %v", err)
+	}
+
+	svc := service.New(&memStorage{orders: map[string]models.Order{}}, cache.New(), checker)
+	decoding := config.Decoding{Mode: strictjson.ModeStrict, MaxBytes: 1 << 20}
+	batch := config.Batch{MaxBytes: 1 << 20, MaxOrders: 3, Timeout: time.Minute}
+
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Route("/api", func(r chi.Router) {
+		r.Post("/orders:batch", NewBatchHandler(svc, decoding, batch, slogdiscard.NewDiscardLogger()).CreateOrders)
+		r.Route("/orders", func(r chi.Router) {
+			h := NewOrderHandler(svc, decoding, slogdiscard.NewDiscardLogger())
+			r.Get("/", h.ListOrders)
+			r.Get("/{orderUID}", h.GetOrder)
+			r.Post("/", h.CreateOrder)
+		})
+	})
+
+	return r
+}
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+
+	doc, err := openapi3.NewLoader().LoadFromData(openapi.Spec())
+	if err != nil {
+		t.Fatalf("failed to load openapi.json: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("openapi.json is invalid: %v", err)
+	}
+
+	// Поле ответа, которого нет в спецификации, тоже считается расхождением
+	for _, ref := range doc.Components.Schemas {
+		s := ref.Value
+		if s.Type == openapi3.TypeObject && s.AdditionalProperties == nil && s.AdditionalPropertiesAllowed == nil {
+			s.AdditionalPropertiesAllowed = openapi3.BoolPtr(false)
+		}
+	}
+
+	return doc
+}
+
+// contractCase является запросом к API и ожидаемым статусом. Ответ сверяется со спецификацией
+type contractCase struct {
+	name    string
+	method  string
+	path    string // путь в спецификации
+	url     string
+	params  map[string]string
+	header  map[string]string
+	body    string
+	status  int
+	prepare func(t *testing.T, h http.Handler)
+}
+
+func TestContract(t *testing.T) {
+	doc := loadSpec(t)
+
+	create := func(uid string) func(t *testing.T, h http.Handler) {
+		return func(t *testing.T, h http.Handler) {
+			rec := serve(h, http.MethodPost, "/api/orders", nil, testOrderJSON(uid))
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("failed to create order %s: %d %s", uid, rec.Code, rec.Body)
+			}
+		}
+	}
+
+	cases := []contractCase{
+		{
+			name: "create order", method: http.MethodPost, path: "/orders", url: "/api/orders",
+			body: testOrderJSON("create"), status: http.StatusCreated,
+		},
+		{
+			name: "create duplicate order", method: http.MethodPost, path: "/orders", url: "/api/orders",
+			body: testOrderJSON("dup"), status: http.StatusConflict, prepare: create("dup"),
+		},
+		{
+			name: "create malformed order", method: http.MethodPost, path: "/orders", url: "/api/orders",
+			body: `{"order_uid": 1}`, status: http.StatusBadRequest,
+		},
+		{
+			name: "create invalid order", method: http.MethodPost, path: "/orders", url: "/api/orders",
+			body: `{"order_uid": "invalid"}`, status: http.StatusBadRequest,
+		},
+		{
+			name: "get order", method: http.MethodGet, path: "/orders/{orderUID}", url: "/api/orders/get",
+			params: map[string]string{"orderUID": "get"}, status: http.StatusOK, prepare: create("get"),
+		},
+		{
+			name: "get order as csv", method: http.MethodGet, path: "/orders/{orderUID}", url: "/api/orders/csv",
+			params: map[string]string{"orderUID": "csv"}, header: map[string]string{"Accept": "text/csv"},
+			status: http.StatusOK, prepare: create("csv"),
+		},
+		{
+			name: "get missing order", method: http.MethodGet, path: "/orders/{orderUID}", url: "/api/orders/missing",
+			params: map[string]string{"orderUID": "missing"}, status: http.StatusNotFound,
+		},
+		{
+			name: "get order with unsupported accept", method: http.MethodGet, path: "/orders/{orderUID}", url: "/api/orders/x",
+			params: map[string]string{"orderUID": "x"}, header: map[string]string{"Accept": "image/png"},
+			status: http.StatusNotAcceptable,
+		},
+		{
+			name: "list orders", method: http.MethodGet, path: "/orders", url: "/api/orders",
+			status: http.StatusOK, prepare: create("list"),
+		},
+		{
+			name: "list orders as ndjson", method: http.MethodGet, path: "/orders", url: "/api/orders",
+			header: map[string]string{"Accept": "application/x-ndjson"}, status: http.StatusOK, prepare: create("list-ndjson"),
+		},
+		{
+			name: "batch", method: http.MethodPost, path: "/orders:batch", url: "/api/orders:batch",
+			header: map[string]string{"Content-Type": "application/x-ndjson"},
+			body: strings.Join([]string{
+				compact(testOrderJSON("batch-1")), `{"order_uid": "batch-invalid"}`, compact(testOrderJSON("batch-1")),
+			}, "\n"),
+			status: http.StatusOK,
+		},
+		{
+			name: "batch with too many orders", method: http.MethodPost, path: "/orders:batch", url: "/api/orders:batch",
+			header: map[string]string{"Content-Type": "application/json"},
+			body:   "[" + strings.Repeat(compact(testOrderJSON("batch-many"))+",", 3) + compact(testOrderJSON("batch-many")) + "]",
+			status: http.StatusMultiStatus,
+		},
+		{
+			name: "batch larger than max bytes", method: http.MethodPost, path: "/orders:batch", url: "/api/orders:batch",
+			header: map[string]string{"Content-Type": "application/json"},
+			body:   `[{"order_uid": "batch-large",` + strings.Repeat(" ", 1<<20) + `}]`,
+			status: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "batch with malformed body", method: http.MethodPost, path: "/orders:batch", url: "/api/orders:batch",
+			header: map[string]string{"Content-Type": "application/json"},
+			body:   `[{"order_uid": `, status: http.StatusBadRequest,
+		},
+		{
+			name: "batch malformed after first order", method: http.MethodPost, path: "/orders:batch", url: "/api/orders:batch",
+			header: map[string]string{"Content-Type": "application/json"},
+			body:   "[" + compact(testOrderJSON("batch-partial")) + `, {"order_uid": `, status: http.StatusMultiStatus,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newTestRouter(t)
+			if tc.prepare != nil {
+				tc.prepare(t, h)
+			}
+
+			rec := serve(h, tc.method, tc.url, tc.header, tc.body)
+			if rec.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+
+			validateResponse(t, doc, tc, rec)
+		})
+	}
+}
+
+// TestContractNotModified проверяет 304 на повторный запрос с ETag первого ответа
+func TestContractNotModified(t *testing.T) {
+	doc := loadSpec(t)
+	h := newTestRouter(t)
+
+	if rec := serve(h, http.MethodPost, "/api/orders", nil, testOrderJSON("etag")); rec.Code != http.StatusCreated {
+		t.Fatalf("failed to create order: %d %s", rec.Code, rec.Body)
+	}
+	first := serve(h, http.MethodGet, "/api/orders/etag", nil, "")
+
+	tc := contractCase{
+		method: http.MethodGet, path: "/orders/{orderUID}", url: "/api/orders/etag",
+		params: map[string]string{"orderUID": "etag"},
+		header: map[string]string{"If-None-Match": first.Header().Get("ETag")},
+	}
+	rec := serve(h, tc.method, tc.url, tc.header, "")
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("status = %d, want 304", rec.Code)
+	}
+
+	validateResponse(t, doc, tc, rec)
+}
+
+func serve(h http.Handler, method, url string, header map[string]string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// validateResponse сверяет статус, заголовки и тело ответа с операцией спецификации.
+// Статус, которого нет в спецификации, тоже считается расхождением
+func validateResponse(t *testing.T, doc *openapi3.T, tc contractCase, rec *httptest.ResponseRecorder) {
+	t.Helper()
+
+	item := doc.Paths.Find(tc.path)
+	if item == nil {
+		t.Fatalf("path %s is not in openapi.json", tc.path)
+	}
+	op := item.GetOperation(tc.method)
+	if op == nil {
+		t.Fatalf("%s %s is not in openapi.json", tc.method, tc.path)
+	}
+
+	req := httptest.NewRequest(tc.method, tc.url, nil)
+	for k, v := range tc.header {
+		req.Header.Set(k, v)
+	}
+
+	opts := &openapi3filter.Options{IncludeResponseStatus: true, MultiError: true}
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: tc.params,
+			Route: &routers.Route{
+				Spec: doc, Path: tc.path, PathItem: item, Method: tc.method, Operation: op,
+			},
+			Options: opts,
+		},
+		Status:  rec.Code,
+		Header:  rec.Header(),
+		Body:    io.NopCloser(bytes.NewReader(rec.Body.Bytes())),
+		Options: opts,
+	}
+
+	if err := openapi3filter.ValidateResponse(context.Background(), input); err != nil {
+		t.Errorf("response does not match openapi.json: %v\nbody: %s", err, rec.Body)
+	}
+
+	if strings.HasPrefix(rec.Header().Get("Content-Type"), orderenc.ContentTypeNDJSON) {
+		schema := doc.Components.Schemas["Order"].Value
+		for i, line := range strings.Split(strings.TrimSpace(rec.Body.String()), "\n") {
+			var v any
+			if err := json.Unmarshal([]byte(line), &v); err != nil {
+				t.Fatalf("ndjson line %d: %v", i, err)
+			}
+			if err := schema.VisitJSON(v); err != nil {
+				t.Errorf("ndjson line %d does not match Order: %v", i, err)
+			}
+		}
+	}
+}
+
+func compact(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
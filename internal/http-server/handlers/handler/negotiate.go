@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"L0/internal/lib/orderenc"
+	"L0/internal/models"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// flushEvery задает, через сколько заказов потоковый ответ сбрасывается клиенту
+const flushEvery = 100
+
+// formats перечисляет поддерживаемые представления в порядке предпочтения
+var formats = []struct {
+	mediaType string
+	format    string
+}{
+	{orderenc.ContentTypeJSON, orderenc.FormatJSON},
+	{orderenc.ContentTypeNDJSON, orderenc.FormatNDJSON},
+	{orderenc.ContentTypeCSV, orderenc.FormatCSV},
+}
+
+// negotiateFormat выбирает формат ответа по заголовку Accept с учетом q-параметров.
+// Возвращает false, если ни один из форматов клиенту не подходит
+func negotiateFormat(r *http.Request) (string, bool) {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return orderenc.FormatJSON, true
+	}
+
+	best, bestQ := "", 0.0
+	for _, f := range formats {
+		if q := acceptQuality(accept, f.mediaType); q > bestQ {
+			best, bestQ = f.format, q
+		}
+	}
+
+	return best, best != ""
+}
+
+// acceptQuality возвращает q наиболее точного совпадения mediaType с Accept
+func acceptQuality(accept, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var s int
+		switch mt {
+		case mediaType:
+			s = 2
+		case typ + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s < specificity {
+			continue
+		}
+
+		pq := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				pq = parsed
+			}
+		}
+		q, specificity = pq, s
+	}
+
+	return q
+}
+
+// writeOrders потоково пишет заказы в выбранном формате, периодически сбрасывая ответ клиенту
+func writeOrders(w http.ResponseWriter, status int, format string, orders []models.Order) {
+	w.Header().Set("Content-Type", orderenc.ContentType(format))
+	w.WriteHeader(status)
+
+	ow, err := orderenc.NewWriter(format, w)
+	if err != nil {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	for i, order := range orders {
+		if err := ow.Write(order); err != nil {
+			return
+		}
+		if flusher != nil && (i+1)%flushEvery == 0 {
+			if err := ow.Flush(); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+
+	_ = ow.Close()
+}
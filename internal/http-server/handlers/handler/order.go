@@ -1,24 +1,49 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"io"
+	"log/slog"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/render"
 
+	"L0/internal/config"
+	"L0/internal/http-server/conditional"
+	"L0/internal/lib/audit"
+	"L0/internal/lib/orderenc"
+	"L0/internal/lib/strictjson"
 	"L0/internal/models"
 	"L0/internal/service"
 )
 
 type OrderHandler struct {
-	service *service.OrderService
+	service  *service.OrderService
+	decoding config.Decoding
+	log      *slog.Logger
 }
 
-// NewOrderHandler создает новый хендлер
-func NewOrderHandler(s *service.OrderService) *OrderHandler {
-	return &OrderHandler{service: s}
+// NewOrderHandler создает новый хендлер. decoding задает разбор тела CreateOrder
+func NewOrderHandler(s *service.OrderService, decoding config.Decoding, log *slog.Logger) *OrderHandler {
+	return &OrderHandler{
+		service:  s,
+		decoding: decoding,
+		log:      log.With(slog.String("component", "handler/order")),
+	}
+}
+
+// sourceHTTP помечает заказы, созданные через HTTP API
+const sourceHTTP = "http-api"
+
+// auditContext связывает сохраняемые заказы с request ID запроса
+func auditContext(r *http.Request) context.Context {
+	return audit.WithInfo(r.Context(), audit.Info{
+		TraceID:      middleware.GetReqID(r.Context()),
+		SourceSystem: sourceHTTP,
+	})
 }
 
 // GetOrder получает заказ
@@ -30,6 +55,13 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	format, ok := negotiateFormat(r)
+	if !ok {
+		render.Status(r, http.StatusNotAcceptable)
+		render.JSON(w, r, map[string]string{"error": "unsupported Accept"})
+		return
+	}
+
 	order, err := h.service.GetOrder(orderUID)
 	if err != nil {
 		if errors.Is(err, service.ErrOrderNotFound) {
@@ -42,29 +74,109 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	etag, err := conditional.ETag(order)
+	if err != nil {
+		render.Status(r, http.StatusInternalServerError)
+		render.JSON(w, r, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// У каждого представления свой сильный ETag
+	if format != orderenc.FormatJSON {
+		etag = etag[:len(etag)-1] + "-" + format + `"`
+	}
+
+	w.Header().Add("Vary", "Accept")
+	conditional.SetHeaders(w, etag, order.DateCreated)
+	if conditional.NotModified(w, r, etag, order.DateCreated) {
+		return
+	}
+
+	if format != orderenc.FormatJSON {
+		writeOrders(w, http.StatusOK, format, []models.Order{*order})
+		return
+	}
+
 	render.JSON(w, r, order)
 }
 
 // CreateOrder создает новый заказ
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.decoding.MaxBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			render.Status(r, http.StatusRequestEntityTooLarge)
+			render.JSON(w, r, map[string]string{"error": "request body too large"})
+			return
+		}
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, map[string]string{"error": "invalid request body"})
+		return
+	}
+
 	var order models.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+	problems, err := strictjson.Unmarshal(body, &order, h.decoding.Mode)
+	if err != nil {
+		var jsonErr *strictjson.Error
+		if errors.As(err, &jsonErr) {
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]any{"error": "invalid request body", "reasons": jsonErr.Problems})
+			return
+		}
 		render.Status(r, http.StatusBadRequest)
 		render.JSON(w, r, map[string]string{"error": "invalid request body"})
 		return
 	}
+	if len(problems) > 0 {
+		h.log.Warn("accepted order with unexpected JSON",
+			slog.String("request_id", middleware.GetReqID(r.Context())),
+			slog.String("order_uid", order.OrderUID),
+			slog.Any("problems", problems),
+		)
+	}
 
-	if err := h.service.SaveOrder(&order); err != nil {
+	if err := h.service.SaveOrder(auditContext(r), &order); err != nil {
+		var validationErr *models.ValidationError
+		switch {
+		case errors.As(err, &validationErr):
+			render.Status(r, http.StatusBadRequest)
+			render.JSON(w, r, map[string]any{"error": "invalid order", "reasons": validationErr.Reasons})
+			return
+		case errors.Is(err, service.ErrOrderExists):
+			render.Status(r, http.StatusConflict)
+			render.JSON(w, r, map[string]string{"error": err.Error()})
+			return
+		}
 		render.Status(r, http.StatusInternalServerError)
 		render.JSON(w, r, map[string]string{"error": err.Error()})
 		return
 	}
 
+	if etag, err := conditional.ETag(order); err == nil {
+		conditional.SetHeaders(w, etag, order.DateCreated)
+	}
+
 	render.Status(r, http.StatusCreated)
 	render.JSON(w, r, order)
 }
 
+// ListOrders отдает все заказы в формате, согласованном по Accept
 func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	format, ok := negotiateFormat(r)
+	if !ok {
+		render.Status(r, http.StatusNotAcceptable)
+		render.JSON(w, r, map[string]string{"error": "unsupported Accept"})
+		return
+	}
+
 	orders := h.service.GetAllOrders()
-	render.JSON(w, r, orders)
+
+	w.Header().Add("Vary", "Accept")
+	if format == orderenc.FormatJSON {
+		render.JSON(w, r, orders)
+		return
+	}
+
+	writeOrders(w, http.StatusOK, format, orders)
 }
@@ -0,0 +1,29 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+//go:embed swagger.html
+var swaggerUI []byte
+
+// Spec возвращает сырую OpenAPI спецификацию
+func Spec() []byte {
+	return spec
+}
+
+// SpecHandler отдает OpenAPI спецификацию в формате JSON
+func SpecHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(spec)
+}
+
+// UIHandler отдает страницу Swagger UI для спецификации
+func UIHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(swaggerUI)
+}
@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"L0/internal/config"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/render"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Role string
+
+const (
+	RoleRead  Role = "read"
+	RoleWrite Role = "write"
+)
+
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+
+	headerAPIKey = "X-API-Key"
+)
+
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Identity описывает вызывающую сторону запроса
+type Identity struct {
+	Name   string
+	Role   Role
+	Method string
+}
+
+// Allows проверяет, достаточно ли роли для доступа. Запись включает чтение
+func (i Identity) Allows(role Role) bool {
+	switch i.Role {
+	case RoleWrite:
+		return role == RoleWrite || role == RoleRead
+	case RoleRead:
+		return role == RoleRead
+	default:
+		return false
+	}
+}
+
+type ctxKey struct{}
+
+type result struct {
+	identity Identity
+	err      error
+}
+
+// IdentityFromContext возвращает аутентифицированного клиента из контекста запроса
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	res, ok := ctx.Value(ctxKey{}).(result)
+	if !ok || res.err != nil {
+		return Identity{}, false
+	}
+
+	return res.identity, true
+}
+
+type keySet struct {
+	enabled  bool
+	apiKeys  map[[sha256.Size]byte]Identity
+	jwtKeys  map[string][]byte
+	issuer   string
+	audience string
+}
+
+// Authenticator проверяет API ключи и JWT. Набор ключей можно заменить на лету через Update
+type Authenticator struct {
+	mu   sync.RWMutex
+	keys *keySet
+}
+
+// New создает аутентификатор по настройкам из конфига
+func New(cfg config.Auth) (*Authenticator, error) {
+	a := &Authenticator{}
+	if err := a.Update(cfg); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Update атомарно заменяет набор ключей, используется для ротации без рестарта
+func (a *Authenticator) Update(cfg config.Auth) error {
+	keys, err := buildKeySet(cfg)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.mu.Unlock()
+
+	return nil
+}
+
+func buildKeySet(cfg config.Auth) (*keySet, error) {
+	keys := &keySet{
+		enabled:  cfg.Enabled,
+		apiKeys:  make(map[[sha256.Size]byte]Identity, len(cfg.APIKeys)),
+		jwtKeys:  make(map[string][]byte, len(cfg.JWT.Keys)),
+		issuer:   cfg.JWT.Issuer,
+		audience: cfg.JWT.Audience,
+	}
+
+	for _, k := range cfg.APIKeys {
+		if k.Key == "" {
+			return nil, fmt.Errorf("api key %q is empty", k.Name)
+		}
+		role, err := parseRole(k.Role)
+		if err != nil {
+			return nil, fmt.Errorf("api key %q: %w", k.Name, err)
+		}
+		keys.apiKeys[sha256.Sum256([]byte(k.Key))] = Identity{Name: k.Name, Role: role, Method: MethodAPIKey}
+	}
+
+	for _, k := range cfg.JWT.Keys {
+		if k.Secret == "" {
+			return nil, fmt.Errorf("jwt key %q has empty secret", k.ID)
+		}
+		keys.jwtKeys[k.ID] = []byte(k.Secret)
+	}
+
+	return keys, nil
+}
+
+func parseRole(s string) (Role, error) {
+	switch Role(s) {
+	case RoleRead, RoleWrite:
+		return Role(s), nil
+	case "":
+		return RoleRead, nil
+	default:
+		return "", fmt.Errorf("unknown role %q", s)
+	}
+}
+
+func (a *Authenticator) current() *keySet {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.keys
+}
+
+// Authenticate определяет клиента по заголовкам и кладет результат в контекст.
+// Сам запрос не отклоняется, это делает Require на конкретных роутах
+func (a *Authenticator) Authenticate(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		identity, err := a.identify(r)
+		ctx := context.WithValue(r.Context(), ctxKey{}, result{identity: identity, err: err})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// Require пропускает только клиентов с нужной ролью
+func (a *Authenticator) Require(role Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if !a.current().enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res, _ := r.Context().Value(ctxKey{}).(result)
+			if res.err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="orders"`)
+				render.Status(r, http.StatusUnauthorized)
+				render.JSON(w, r, map[string]string{"error": res.err.Error()})
+				return
+			}
+
+			if !res.identity.Allows(role) {
+				render.Status(r, http.StatusForbidden)
+				render.JSON(w, r, map[string]string{"error": "insufficient role"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+func (a *Authenticator) identify(r *http.Request) (Identity, error) {
+	keys := a.current()
+
+	if key := r.Header.Get(headerAPIKey); key != "" {
+		identity, ok := keys.apiKeys[sha256.Sum256([]byte(key))]
+		if !ok {
+			return Identity{}, ErrInvalidCredentials
+		}
+		return identity, nil
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return Identity{}, ErrNoCredentials
+	}
+
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	return keys.parseJWT(token)
+}
+
+type claims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+func (k *keySet) parseJWT(raw string) (Identity, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if k.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(k.issuer))
+	}
+	if k.audience != "" {
+		opts = append(opts, jwt.WithAudience(k.audience))
+	}
+
+	var c claims
+	_, err := jwt.ParseWithClaims(raw, &c, k.lookupKey, opts...)
+	if err != nil {
+		return Identity{}, ErrInvalidCredentials
+	}
+	// sub является именем клиента, по нему же считается лимит запросов
+	if c.Subject == "" {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	role, err := parseRole(c.Role)
+	if err != nil {
+		return Identity{}, ErrInvalidCredentials
+	}
+
+	return Identity{Name: c.Subject, Role: role, Method: MethodJWT}, nil
+}
+
+// lookupKey выбирает ключ по kid. Без kid подходит только единственный ключ в наборе
+func (k *keySet) lookupKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid != "" {
+		secret, ok := k.jwtKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		return secret, nil
+	}
+
+	if len(k.jwtKeys) == 1 {
+		for _, secret := range k.jwtKeys {
+			return secret, nil
+		}
+	}
+
+	return nil, errors.New("token has no kid")
+}
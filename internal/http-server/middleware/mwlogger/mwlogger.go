@@ -1,6 +1,7 @@
 package mwlogger
 
 import (
+	"L0/internal/http-server/middleware/auth"
 	"github.com/go-chi/chi/v5/middleware"
 	"log/slog"
 	"net/http"
@@ -19,6 +20,7 @@ func New(log *slog.Logger) func(next http.Handler) http.Handler {
 				slog.String("method", r.Method),
 				slog.String("path", r.URL.Path),
 				slog.String("remote_address", r.RemoteAddr),
+				slog.String("caller", caller(r)),
 			)
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMinor)
 
@@ -37,3 +39,12 @@ func New(log *slog.Logger) func(next http.Handler) http.Handler {
 		return http.HandlerFunc(fn)
 	}
 }
+
+// caller возвращает имя клиента, определенного auth middleware
+func caller(r *http.Request) string {
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+		return identity.Name
+	}
+
+	return "anonymous"
+}
@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"L0/internal/config"
+	"L0/internal/http-server/middleware/auth"
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/render"
+)
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// Limiter ограничивает частоту запросов по token bucket на пару роут+клиент.
+// Число отслеживаемых клиентов ограничено, давно неактивные вытесняются первыми
+type Limiter struct {
+	enabled    bool
+	def        config.Limit
+	routes     map[string]config.Limit
+	maxClients int
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List
+	now     func() time.Time
+}
+
+// New создает лимитер по настройкам из конфига
+func New(cfg config.RateLimit) *Limiter {
+	maxClients := cfg.MaxClients
+	if maxClients <= 0 {
+		maxClients = 10000
+	}
+
+	return &Limiter{
+		enabled:    cfg.Enabled,
+		def:        cfg.Default,
+		routes:     cfg.Routes,
+		maxClients: maxClients,
+		buckets:    make(map[string]*list.Element),
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// Limit возвращает middleware с лимитом для роута с указанным именем
+func (l *Limiter) Limit(route string) func(next http.Handler) http.Handler {
+	limit := l.def
+	if rl, ok := l.routes[route]; ok {
+		limit = rl
+	}
+	if limit.Burst < 1 {
+		limit.Burst = int(math.Max(1, math.Ceil(limit.RPS)))
+	}
+
+	return func(next http.Handler) http.Handler {
+		if !l.enabled || limit.RPS <= 0 {
+			return next
+		}
+
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			allowed, remaining, wait := l.take(route+"|"+clientKey(r), limit)
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(resetSeconds(limit, remaining)))
+
+			if !allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				render.Status(r, http.StatusTooManyRequests)
+				render.JSON(w, r, map[string]string{"error": "rate limit exceeded"})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+
+		return http.HandlerFunc(fn)
+	}
+}
+
+// take списывает токен из корзины клиента. Возвращает остаток токенов и время до следующего
+func (l *Limiter) take(key string, limit config.Limit) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b := l.bucket(key, limit, now)
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.RPS)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limit.RPS * float64(time.Second))
+		return false, 0, wait
+	}
+
+	b.tokens--
+
+	return true, int(b.tokens), 0
+}
+
+func (l *Limiter) bucket(key string, limit config.Limit, now time.Time) *bucket {
+	if el, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(el)
+		return el.Value.(*bucket)
+	}
+
+	for l.lru.Len() >= l.maxClients {
+		oldest := l.lru.Back()
+		l.lru.Remove(oldest)
+		delete(l.buckets, oldest.Value.(*bucket).key)
+	}
+
+	b := &bucket{key: key, tokens: float64(limit.Burst), last: now}
+	l.buckets[key] = l.lru.PushFront(b)
+
+	return b
+}
+
+// resetSeconds считает, через сколько секунд корзина снова будет полной
+func resetSeconds(limit config.Limit, remaining int) int {
+	missing := float64(limit.Burst - remaining)
+	return int(math.Ceil(missing / limit.RPS))
+}
+
+// clientKey идентифицирует клиента по API ключу или JWT, а для анонимных запросов по IP
+func clientKey(r *http.Request) string {
+	if identity, ok := auth.IdentityFromContext(r.Context()); ok {
+		return identity.Method + ":" + identity.Name
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
@@ -0,0 +1,227 @@
+package codec
+
+import (
+	"L0/internal/lib/money"
+	"L0/internal/models"
+	"bytes"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/pkg/crc64"
+)
+
+// avroSchema является текущей схемой заказа, суммы в ней дублируются полями *_minor
+//
+//go:embed order.avsc
+var avroSchema string
+
+// avroSchemaV1 является прежней схемой с суммами только в целых единицах валюты.
+// Ею записаны сообщения без заголовка single-object encoding
+//
+//go:embed order.v1.avsc
+var avroSchemaV1 string
+
+// avroMagic начинает сообщение в формате Avro single-object encoding, за ним идет
+// CRC-64-AVRO отпечаток схемы писателя в little-endian
+var avroMagic = []byte{0xC3, 0x01}
+
+const avroHeaderSize = 10
+
+// avroAPI сопоставляет поля Avro записи с json тегами models.Order
+var avroAPI = avro.Config{TagKey: "json"}.Freeze()
+
+// avroOrder добавляет к заказу поля *_minor схемы order.avsc. Поля верхнего уровня
+// перекрывают одноименные поля встроенной модели
+type avroOrder struct {
+	models.Order
+	Payment avroPayment `json:"payment"`
+	Items   []avroItem  `json:"items"`
+}
+
+type avroPayment struct {
+	models.Payment
+	AmountMinor       *int64 `json:"amount_minor"`
+	DeliveryCostMinor *int64 `json:"delivery_cost_minor"`
+	GoodsTotalMinor   *int64 `json:"goods_total_minor"`
+	CustomFeeMinor    *int64 `json:"custom_fee_minor"`
+}
+
+type avroItem struct {
+	models.Item
+	PriceMinor      *int64 `json:"price_minor"`
+	TotalPriceMinor *int64 `json:"total_price_minor"`
+}
+
+// Avro кодирует заказ в бинарный Avro по схеме order.avsc
+type Avro struct {
+	schema      avro.Schema
+	fingerprint []byte
+	// writers содержит схемы для чтения по отпечатку схемы писателя
+	writers map[uint64]avro.Schema
+	// legacy читает сообщения без заголовка, записанные схемой order.v1.avsc
+	legacy avro.Schema
+}
+
+// NewAvro разбирает встроенные схемы и готовит чтение сообщений прежней схемы
+func NewAvro() (*Avro, error) {
+	s, err := avro.Parse(avroSchema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse avro schema: %w", err)
+	}
+	// Схемы разбираются в отдельные кэши, потому что имена записей в них совпадают
+	v1, err := avro.ParseWithCache(avroSchemaV1, "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse avro schema v1: %w", err)
+	}
+
+	legacy, err := avro.NewSchemaCompatibility().Resolve(s, v1)
+	if err != nil {
+		return nil, fmt.Errorf("avro schema is incompatible with v1: %w", err)
+	}
+
+	fp := avroFingerprint(s)
+	a := &Avro{
+		schema:      s,
+		fingerprint: binary.LittleEndian.AppendUint64(nil, fp),
+		writers: map[uint64]avro.Schema{
+			fp:                  s,
+			avroFingerprint(v1): legacy,
+		},
+		legacy: legacy,
+	}
+
+	return a, nil
+}
+
+// avroFingerprint считает CRC-64-AVRO отпечаток канонической формы схемы
+func avroFingerprint(s avro.Schema) uint64 {
+	h := crc64.New()
+	_, _ = h.Write([]byte(s.String()))
+	return h.Sum64()
+}
+
+func (a *Avro) ContentType() string {
+	return ContentTypeAvro
+}
+
+// Decode читает заказ в формате single-object encoding любой известной версии схемы
+// или сообщение без заголовка в схеме order.v1.avsc. Поля *_minor заменяют суммы
+// в целых единицах, если они пришли
+func (a *Avro) Decode(data []byte, _ string) (models.Order, error) {
+	// Сообщение без заголовка не может начинаться с avroMagic: это отрицательная
+	// длина строки order_uid
+	writer := a.legacy
+	if bytes.HasPrefix(data, avroMagic) {
+		if len(data) < avroHeaderSize {
+			return models.Order{}, fmt.Errorf("failed to decode avro order: header is truncated")
+		}
+		fp := binary.LittleEndian.Uint64(data[len(avroMagic):avroHeaderSize])
+		s, ok := a.writers[fp]
+		if !ok {
+			return models.Order{}, fmt.Errorf("failed to decode avro order: unknown schema fingerprint %x", fp)
+		}
+		writer, data = s, data[avroHeaderSize:]
+	}
+
+	var msg avroOrder
+	if err := avroAPI.Unmarshal(writer, data, &msg); err != nil {
+		return models.Order{}, fmt.Errorf("failed to decode avro order: %w", err)
+	}
+
+	order := msg.Order
+	order.Payment = msg.Payment.Payment
+	if msg.Items != nil {
+		order.Items = make([]models.Item, len(msg.Items))
+	}
+	for i, item := range msg.Items {
+		order.Items[i] = item.Item
+	}
+
+	// Avro пишет long прямо в money.Amount, переводим целые единицы в сумму
+	for _, f := range order.AmountFields() {
+		amount, err := money.Major(int64(*f.Amount))
+		if err != nil {
+			return models.Order{}, fmt.Errorf("failed to decode avro order: %s: %w", f.Path, err)
+		}
+		*f.Amount = amount
+	}
+
+	currency := money.CurrencyOf(order.Payment.Currency)
+	p := &order.Payment
+	err := applyMinor(currency,
+		[]*int64{msg.Payment.AmountMinor, msg.Payment.DeliveryCostMinor, msg.Payment.GoodsTotalMinor, msg.Payment.CustomFeeMinor},
+		&p.Amount, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee)
+	if err != nil {
+		return models.Order{}, fmt.Errorf("failed to decode avro order: payment: %w", err)
+	}
+	for i, item := range msg.Items {
+		err := applyMinor(currency, []*int64{item.PriceMinor, item.TotalPriceMinor},
+			&order.Items[i].Price, &order.Items[i].TotalPrice)
+		if err != nil {
+			return models.Order{}, fmt.Errorf("failed to decode avro order: items[%d]: %w", i, err)
+		}
+	}
+
+	return order, nil
+}
+
+// Encode пишет заказ по схеме order.avsc в формате single-object encoding. Суммы пишутся
+// в минорных единицах, а в прежние поля в целых единицах попадают только целые суммы,
+// дробные там равны 0, как у незаполненных полей protobuf
+func (a *Avro) Encode(order models.Order) ([]byte, error) {
+	currency := money.CurrencyOf(order.Payment.Currency)
+
+	msg := avroOrder{Order: order, Items: make([]avroItem, len(order.Items))}
+
+	p := &msg.Payment
+	p.Payment = order.Payment
+	minor, err := avroMinor(currency, &p.Amount, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee)
+	if err != nil {
+		return nil, fmt.Errorf("payment: %w", err)
+	}
+	p.AmountMinor, p.DeliveryCostMinor, p.GoodsTotalMinor, p.CustomFeeMinor = minor[0], minor[1], minor[2], minor[3]
+
+	for i, item := range order.Items {
+		it := &msg.Items[i]
+		it.Item = item
+		minor, err := avroMinor(currency, &it.Price, &it.TotalPrice)
+		if err != nil {
+			return nil, fmt.Errorf("items[%d]: %w", i, err)
+		}
+		it.PriceMinor, it.TotalPriceMinor = minor[0], minor[1]
+	}
+
+	body, err := avroAPI.Marshal(a.schema, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 0, avroHeaderSize+len(body))
+	b = append(b, avroMagic...)
+	b = append(b, a.fingerprint...)
+
+	return append(b, body...), nil
+}
+
+// avroMinor переводит суммы в минорные единицы, а сами суммы заменяет значениями
+// прежних полей в целых единицах, которые avroAPI пишет как long
+func avroMinor(currency money.Currency, amounts ...*money.Amount) ([]*int64, error) {
+	minor := make([]*int64, len(amounts))
+	for i, a := range amounts {
+		v, err := a.Minor(currency)
+		if err != nil {
+			return nil, err
+		}
+		minor[i] = &v
+
+		if whole, ok := a.Whole(); ok {
+			*a = money.Amount(whole)
+		} else {
+			*a = 0
+		}
+	}
+
+	return minor, nil
+}
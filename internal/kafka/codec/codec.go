@@ -0,0 +1,70 @@
+package codec
+
+import (
+	"L0/internal/models"
+	"errors"
+	"fmt"
+	"mime"
+)
+
+// Типы содержимого, по которым выбирается кодек
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeAvro     = "application/avro"
+)
+
+var ErrUnsupportedContentType = errors.New("unsupported content type")
+
+// Codec переводит тело сообщения в models.Order и обратно.
+// Версия схемы учитывается только форматами, которые версионируются через заголовок
+type Codec interface {
+	ContentType() string
+	Decode(data []byte, schemaVersion string) (models.Order, error)
+	Encode(order models.Order) ([]byte, error)
+}
+
+// Registry выбирает кодек по content-type
+type Registry struct {
+	codecs map[string]Codec
+}
+
+// NewRegistry создает реестр из переданных кодеков
+func NewRegistry(codecs ...Codec) *Registry {
+	r := &Registry{codecs: make(map[string]Codec, len(codecs))}
+	for _, c := range codecs {
+		r.Register(c)
+	}
+
+	return r
+}
+
+// Register добавляет кодек в реестр, заменяя прежний кодек того же формата
+func (r *Registry) Register(c Codec) {
+	r.codecs[c.ContentType()] = c
+}
+
+// Default возвращает реестр со всеми поддерживаемыми форматами
+func Default() (*Registry, error) {
+	avro, err := NewAvro()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRegistry(JSON{}, Protobuf{}, avro), nil
+}
+
+// Lookup находит кодек по content-type, параметры вроде charset игнорируются
+func (r *Registry) Lookup(contentType string) (Codec, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+
+	c, ok := r.codecs[mediaType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedContentType, contentType)
+	}
+
+	return c, nil
+}
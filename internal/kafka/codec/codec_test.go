@@ -0,0 +1,375 @@
+package codec
+
+import (
+	"L0/internal/kafka/schema"
+	"L0/internal/lib/money"
+	"L0/internal/lib/strictjson"
+	"L0/internal/models"
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// testOrder возвращает заказ, который без потерь проходит через все форматы:
+// время в UTC с точностью до микросекунд, как в Avro, и без полей, заполняемых сервисом
+func testOrder(currency string, amounts ...int64) models.Order {
+	c := money.CurrencyOf(currency)
+	a := func(i int) money.Amount {
+		v, err := money.FromMinor(amounts[i], c)
+		if err != nil {
+			panic(err)
+		}
+		return v
+	}
+
+	return models.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name: "Test Testov", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction: "b563feb7b2b84b6test", Currency: currency, Provider: "wbpay",
+			Amount: a(0), PaymentDT: 1637907727, Bank: "alpha", DeliveryCost: a(1), GoodsTotal: a(2), CustomFee: a(3),
+		},
+		Items: []models.Item{
+			{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: a(4), RID: "ab4219087a764ae0btest", Name: "Mascaras",
+				Sale: 30, Size: "0", TotalPrice: a(5), NmID: 2389212, Brand: "Vivienne Sabo", Status: 202},
+			{ChrtID: 1, Name: "Gift"},
+		},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		Shardkey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 123456000, time.UTC),
+		OofShard:        "1",
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	avroCodec, err := NewAvro()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	whole := testOrder("RUB", 181700, 150000, 31700, 0, 45300, 31700)
+	fractional := testOrder("USD", 181750, 150000, 31750, 25, 45350, 31750)
+	jpy := testOrder("JPY", 1817, 1500, 317, 0, 453, 317)
+	kwd := testOrder("KWD", 1817505, 1500000, 317505, 0, 453575, 317505)
+
+	tests := []struct {
+		name   string
+		codec  Codec
+		orders []models.Order
+	}{
+		{"json", JSON{Mode: strictjson.ModeStrict}, []models.Order{whole, fractional, jpy, kwd}},
+		{"protobuf", Protobuf{}, []models.Order{whole, fractional, jpy, kwd}},
+		{"avro", avroCodec, []models.Order{whole, fractional, jpy, kwd}},
+	}
+
+	for _, tt := range tests {
+		for _, order := range tt.orders {
+			t.Run(tt.name+"/"+order.Payment.Currency, func(t *testing.T) {
+				data, err := tt.codec.Encode(order)
+				if err != nil {
+					t.Fatalf("Encode: %v", err)
+				}
+
+				got, err := tt.codec.Decode(data, schema.V1)
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				if !reflect.DeepEqual(got, order) {
+					t.Errorf("round trip mismatch\n got: %+v\nwant: %+v", got, order)
+				}
+			})
+		}
+	}
+}
+
+// orderDescriptor компилирует order.proto, чтобы сверить ручной кодек с тем,
+// что пишет и читает сгенерированный по схеме код
+func orderDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{}),
+	}
+	files, err := compiler.Compile(context.Background(), "order.proto")
+	if err != nil {
+		t.Fatalf("failed to compile order.proto: %v", err)
+	}
+
+	md := files[0].Messages().ByName("Order")
+	if md == nil {
+		t.Fatal("order.proto has no Order message")
+	}
+
+	return md
+}
+
+// dynamicOrder заполняет сообщение order.proto по именам полей. legacy пишет суммы
+// только в устаревшие поля в целых единицах, как старые продюсеры
+func dynamicOrder(t *testing.T, md protoreflect.MessageDescriptor, o models.Order, legacy bool) *dynamicpb.Message {
+	t.Helper()
+
+	set := func(m protoreflect.Message, name string, v any) {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			t.Fatalf("order.proto: %s has no field %s", m.Descriptor().FullName(), name)
+		}
+		m.Set(fd, protoreflect.ValueOf(v))
+	}
+	nested := func(m protoreflect.Message, name string) protoreflect.Message {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			t.Fatalf("order.proto: %s has no field %s", m.Descriptor().FullName(), name)
+		}
+		return m.Mutable(fd).Message()
+	}
+
+	currency := money.CurrencyOf(o.Payment.Currency)
+	amount := func(m protoreflect.Message, name string, a money.Amount) {
+		if legacy {
+			whole, ok := a.Whole()
+			if !ok {
+				t.Fatalf("legacy producer cannot write %s = %s", name, a)
+			}
+			set(m, name, whole)
+			return
+		}
+		if whole, ok := a.Whole(); ok {
+			set(m, name, whole)
+		}
+		minor, err := a.Minor(currency)
+		if err != nil {
+			t.Fatal(err)
+		}
+		set(m, name+"_minor", minor)
+	}
+
+	m := dynamicpb.NewMessage(md)
+	set(m, "order_uid", o.OrderUID)
+	set(m, "track_number", o.TrackNumber)
+	set(m, "entry", o.Entry)
+
+	d := nested(m, "delivery")
+	set(d, "name", o.Delivery.Name)
+	set(d, "phone", o.Delivery.Phone)
+	set(d, "zip", o.Delivery.Zip)
+	set(d, "city", o.Delivery.City)
+	set(d, "address", o.Delivery.Address)
+	set(d, "region", o.Delivery.Region)
+	set(d, "email", o.Delivery.Email)
+
+	p := nested(m, "payment")
+	set(p, "transaction", o.Payment.Transaction)
+	set(p, "request_id", o.Payment.RequestID)
+	set(p, "currency", o.Payment.Currency)
+	set(p, "provider", o.Payment.Provider)
+	amount(p, "amount", o.Payment.Amount)
+	set(p, "payment_dt", o.Payment.PaymentDT)
+	set(p, "bank", o.Payment.Bank)
+	amount(p, "delivery_cost", o.Payment.DeliveryCost)
+	amount(p, "goods_total", o.Payment.GoodsTotal)
+	amount(p, "custom_fee", o.Payment.CustomFee)
+
+	itemsFd := md.Fields().ByName("items")
+	items := m.Mutable(itemsFd).List()
+	for _, item := range o.Items {
+		i := items.NewElement().Message()
+		set(i, "chrt_id", item.ChrtID)
+		set(i, "track_number", item.TrackNumber)
+		amount(i, "price", item.Price)
+		set(i, "rid", item.RID)
+		set(i, "name", item.Name)
+		set(i, "sale", int32(item.Sale))
+		set(i, "size", item.Size)
+		amount(i, "total_price", item.TotalPrice)
+		set(i, "nm_id", item.NmID)
+		set(i, "brand", item.Brand)
+		set(i, "status", int32(item.Status))
+		items.Append(protoreflect.ValueOfMessage(i))
+	}
+
+	set(m, "locale", o.Locale)
+	set(m, "internal_signature", o.InternalSignature)
+	set(m, "customer_id", o.CustomerID)
+	set(m, "delivery_service", o.DeliveryService)
+	set(m, "shardkey", o.Shardkey)
+	set(m, "sm_id", int64(o.SmID))
+	ts := nested(m, "date_created")
+	set(ts, "seconds", o.DateCreated.Unix())
+	set(ts, "nanos", int32(o.DateCreated.Nanosecond()))
+	set(m, "oof_shard", o.OofShard)
+
+	return m
+}
+
+func TestProtobufMatchesProtoFile(t *testing.T) {
+	md := orderDescriptor(t)
+
+	orders := map[string]models.Order{
+		"whole":      testOrder("RUB", 181700, 150000, 31700, 0, 45300, 31700),
+		"fractional": testOrder("USD", 181750, 150000, 31750, 25, 45350, 31750),
+		"jpy":        testOrder("JPY", 1817, 1500, 317, 0, 453, 317),
+	}
+
+	for name, order := range orders {
+		t.Run(name, func(t *testing.T) {
+			want := dynamicOrder(t, md, order, false)
+
+			// Сообщение ручного кодека читается кодом, сгенерированным по order.proto
+			data, err := Protobuf{}.Encode(order)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			got := dynamicpb.NewMessage(md)
+			if err := proto.Unmarshal(data, got); err != nil {
+				t.Fatalf("generated code cannot read the payload: %v", err)
+			}
+			if !proto.Equal(got, want) {
+				t.Errorf("payload differs from order.proto\n got: %v\nwant: %v", got, want)
+			}
+
+			// Сообщение сгенерированного кода читается ручным кодеком
+			generated, err := proto.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := Protobuf{}.Decode(generated, "")
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, order) {
+				t.Errorf("decoded generated payload mismatch\n got: %+v\nwant: %+v", decoded, order)
+			}
+		})
+	}
+}
+
+func TestProtobufLegacyProducer(t *testing.T) {
+	md := orderDescriptor(t)
+	order := testOrder("RUB", 181700, 150000, 31700, 0, 45300, 31700)
+
+	data, err := proto.Marshal(dynamicOrder(t, md, order, true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Protobuf{}.Decode(data, "")
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, order) {
+		t.Errorf("legacy payload mismatch\n got: %+v\nwant: %+v", got, order)
+	}
+}
+
+// legacyAvro пишет заказ прежней схемой order.v1.avsc без заголовка, как старые продюсеры.
+// Суммы в order должны быть уже переведены в целые единицы
+func legacyAvro(t *testing.T, order models.Order) []byte {
+	t.Helper()
+
+	v1, err := avro.ParseWithCache(avroSchemaV1, "", &avro.SchemaCache{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := avroAPI.Marshal(v1, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// wholeUnits переводит суммы заказа в целые единицы, как их пишет прежняя схема
+func wholeUnits(t *testing.T, order models.Order) models.Order {
+	t.Helper()
+
+	order.Items = slices.Clone(order.Items)
+	for _, f := range order.AmountFields() {
+		whole, ok := f.Amount.Whole()
+		if !ok {
+			t.Fatalf("legacy producer cannot write %s = %s", f.Path, *f.Amount)
+		}
+		*f.Amount = money.Amount(whole)
+	}
+
+	return order
+}
+
+func TestAvroLegacyProducer(t *testing.T) {
+	avroCodec, err := NewAvro()
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := testOrder("RUB", 181700, 150000, 31700, 0, 45300, 31700)
+
+	got, err := avroCodec.Decode(legacyAvro(t, wholeUnits(t, order)), "")
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !reflect.DeepEqual(got, order) {
+		t.Errorf("legacy payload mismatch\n got: %+v\nwant: %+v", got, order)
+	}
+}
+
+func TestAvroDecodeErrors(t *testing.T) {
+	avroCodec, err := NewAvro()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := avroCodec.Encode(testOrder("USD", 181750, 150000, 31750, 25, 45350, 31750))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := bytes.Clone(data)
+	unknown[2] ^= 0xFF
+
+	// Цена в целых единицах, которую нельзя перевести в money.Amount
+	overflow := wholeUnits(t, testOrder("JPY", 1817, 1500, 317, 0, 453, 317))
+	overflow.Items[0].Price = math.MaxInt64 / 100
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+		errText string
+	}{
+		{name: "truncated header", data: data[:5], errText: "header is truncated"},
+		{name: "unknown schema", data: unknown, errText: "unknown schema fingerprint"},
+		{name: "amount overflow", data: legacyAvro(t, overflow), wantErr: money.ErrRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := avroCodec.Decode(tt.data, "")
+			if err == nil {
+				t.Fatal("Decode succeeded, want error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Decode error %v, want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("Decode error %q, want %q", err, tt.errText)
+			}
+		})
+	}
+}
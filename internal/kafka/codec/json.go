@@ -0,0 +1,47 @@
+package codec
+
+import (
+	"L0/internal/kafka/schema"
+	"L0/internal/lib/strictjson"
+	"L0/internal/models"
+	"encoding/json"
+	"log/slog"
+)
+
+// JSON декодирует заказы версионированных JSON схем, см. пакет schema.
+// Mode задает режим strictjson, по умолчанию неизвестные поля игнорируются.
+// В режиме logged нарушения пишутся в Log
+type JSON struct {
+	Mode string
+	Log  *slog.Logger
+}
+
+func (JSON) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (j JSON) Decode(data []byte, schemaVersion string) (models.Order, error) {
+	var problems []string
+	order, err := schema.DecodeWith(schemaVersion, data, func(data []byte, v any) error {
+		var err error
+		problems, err = strictjson.Unmarshal(data, v, j.Mode)
+		return err
+	})
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	if len(problems) > 0 && j.Log != nil {
+		j.Log.Warn("accepted order with unexpected JSON",
+			slog.String("order_uid", order.OrderUID),
+			slog.Any("problems", problems),
+		)
+	}
+
+	return order, nil
+}
+
+// Encode пишет заказ в схеме версии 1
+func (JSON) Encode(order models.Order) ([]byte, error) {
+	return json.Marshal(order)
+}
@@ -0,0 +1,418 @@
+package codec
+
+import (
+	"L0/internal/lib/money"
+	"L0/internal/models"
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Protobuf кодирует заказ по схеме order.proto. Номера полей должны совпадать с .proto файлом
+type Protobuf struct{}
+
+func (Protobuf) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (Protobuf) Decode(data []byte, _ string) (models.Order, error) {
+	var (
+		o            models.Order
+		paymentMinor [4]*int64
+		itemsMinor   [][2]*int64
+	)
+
+	err := walk(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return str(typ, b, &o.OrderUID)
+		case 2:
+			return str(typ, b, &o.TrackNumber)
+		case 3:
+			return str(typ, b, &o.Entry)
+		case 4:
+			return message(typ, b, func(m []byte) error { return decodeDelivery(m, &o.Delivery) })
+		case 5:
+			return message(typ, b, func(m []byte) error { return decodePayment(m, &o.Payment, &paymentMinor) })
+		case 6:
+			return message(typ, b, func(m []byte) error {
+				var (
+					item  models.Item
+					minor [2]*int64
+				)
+				if err := decodeItem(m, &item, &minor); err != nil {
+					return err
+				}
+				o.Items = append(o.Items, item)
+				itemsMinor = append(itemsMinor, minor)
+				return nil
+			})
+		case 7:
+			return str(typ, b, &o.Locale)
+		case 8:
+			return str(typ, b, &o.InternalSignature)
+		case 9:
+			return str(typ, b, &o.CustomerID)
+		case 10:
+			return str(typ, b, &o.DeliveryService)
+		case 11:
+			return str(typ, b, &o.Shardkey)
+		case 12:
+			return integer(typ, b, &o.SmID)
+		case 13:
+			return message(typ, b, func(m []byte) error { return decodeTimestamp(m, &o.DateCreated) })
+		case 14:
+			return str(typ, b, &o.OofShard)
+		}
+		return skip(num, typ, b)
+	})
+	if err != nil {
+		return models.Order{}, fmt.Errorf("failed to decode protobuf order: %w", err)
+	}
+
+	// Поля *_minor зависят от валюты, которая может прийти после товаров
+	currency := money.CurrencyOf(o.Payment.Currency)
+	err = applyMinor(currency, paymentMinor[:], &o.Payment.Amount, &o.Payment.DeliveryCost, &o.Payment.GoodsTotal, &o.Payment.CustomFee)
+	if err != nil {
+		return models.Order{}, fmt.Errorf("failed to decode protobuf order: payment: %w", err)
+	}
+	for i := range o.Items {
+		if err := applyMinor(currency, itemsMinor[i][:], &o.Items[i].Price, &o.Items[i].TotalPrice); err != nil {
+			return models.Order{}, fmt.Errorf("failed to decode protobuf order: items[%d]: %w", i, err)
+		}
+	}
+
+	return o, nil
+}
+
+func (Protobuf) Encode(o models.Order) ([]byte, error) {
+	var b []byte
+
+	b = appendString(b, 1, o.OrderUID)
+	b = appendString(b, 2, o.TrackNumber)
+	b = appendString(b, 3, o.Entry)
+	b = appendMessage(b, 4, encodeDelivery(o.Delivery))
+	currency := money.CurrencyOf(o.Payment.Currency)
+	payment, err := encodePayment(o.Payment, currency)
+	if err != nil {
+		return nil, err
+	}
+	b = appendMessage(b, 5, payment)
+	for i, item := range o.Items {
+		encoded, err := encodeItem(item, currency)
+		if err != nil {
+			return nil, fmt.Errorf("items[%d]: %w", i, err)
+		}
+		// Пустой товар все равно пишется, иначе потеряется его позиция в списке
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, encoded)
+	}
+	b = appendString(b, 7, o.Locale)
+	b = appendString(b, 8, o.InternalSignature)
+	b = appendString(b, 9, o.CustomerID)
+	b = appendString(b, 10, o.DeliveryService)
+	b = appendString(b, 11, o.Shardkey)
+	b = appendInt(b, 12, int64(o.SmID))
+	if !o.DateCreated.IsZero() {
+		b = appendMessage(b, 13, encodeTimestamp(o.DateCreated))
+	}
+	b = appendString(b, 14, o.OofShard)
+
+	return b, nil
+}
+
+func decodeDelivery(data []byte, d *models.Delivery) error {
+	fields := []*string{&d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email}
+
+	return walk(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num >= 1 && int(num) <= len(fields) {
+			return str(typ, b, fields[num-1])
+		}
+		return skip(num, typ, b)
+	})
+}
+
+func encodeDelivery(d models.Delivery) []byte {
+	var b []byte
+	for i, v := range []string{d.Name, d.Phone, d.Zip, d.City, d.Address, d.Region, d.Email} {
+		b = appendString(b, protowire.Number(i+1), v)
+	}
+	return b
+}
+
+// decodePayment читает оплату. Суммы из устаревших полей в целых единицах пишутся сразу,
+// а из полей *_minor откладываются в minor до того, как станет известна валюта
+func decodePayment(data []byte, p *models.Payment, minor *[4]*int64) error {
+	return walk(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return str(typ, b, &p.Transaction)
+		case 2:
+			return str(typ, b, &p.RequestID)
+		case 3:
+			return str(typ, b, &p.Currency)
+		case 4:
+			return str(typ, b, &p.Provider)
+		case 5:
+			return major(typ, b, &p.Amount)
+		case 6:
+			return integer(typ, b, &p.PaymentDT)
+		case 7:
+			return str(typ, b, &p.Bank)
+		case 8:
+			return major(typ, b, &p.DeliveryCost)
+		case 9:
+			return major(typ, b, &p.GoodsTotal)
+		case 10:
+			return major(typ, b, &p.CustomFee)
+		case 11, 12, 13, 14:
+			return minorUnits(typ, b, &minor[num-11])
+		}
+		return skip(num, typ, b)
+	})
+}
+
+// encodePayment пишет суммы в минорных единицах, а в устаревшие поля только целые суммы
+func encodePayment(p models.Payment, currency money.Currency) ([]byte, error) {
+	minor, err := money.MinorUnits(currency, p.Amount, p.DeliveryCost, p.GoodsTotal, p.CustomFee)
+	if err != nil {
+		return nil, fmt.Errorf("payment: %w", err)
+	}
+
+	var b []byte
+	b = appendString(b, 1, p.Transaction)
+	b = appendString(b, 2, p.RequestID)
+	b = appendString(b, 3, p.Currency)
+	b = appendString(b, 4, p.Provider)
+	b = appendMajor(b, 5, p.Amount)
+	b = appendInt(b, 6, p.PaymentDT)
+	b = appendString(b, 7, p.Bank)
+	b = appendMajor(b, 8, p.DeliveryCost)
+	b = appendMajor(b, 9, p.GoodsTotal)
+	b = appendMajor(b, 10, p.CustomFee)
+	for i, v := range minor {
+		b = appendInt(b, protowire.Number(11+i), v)
+	}
+	return b, nil
+}
+
+func decodeItem(data []byte, i *models.Item, minor *[2]*int64) error {
+	return walk(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return integer(typ, b, &i.ChrtID)
+		case 2:
+			return str(typ, b, &i.TrackNumber)
+		case 3:
+			return major(typ, b, &i.Price)
+		case 4:
+			return str(typ, b, &i.RID)
+		case 5:
+			return str(typ, b, &i.Name)
+		case 6:
+			return integer(typ, b, &i.Sale)
+		case 7:
+			return str(typ, b, &i.Size)
+		case 8:
+			return major(typ, b, &i.TotalPrice)
+		case 9:
+			return integer(typ, b, &i.NmID)
+		case 10:
+			return str(typ, b, &i.Brand)
+		case 11:
+			return integer(typ, b, &i.Status)
+		case 12, 13:
+			return minorUnits(typ, b, &minor[num-12])
+		}
+		return skip(num, typ, b)
+	})
+}
+
+func encodeItem(i models.Item, currency money.Currency) ([]byte, error) {
+	minor, err := money.MinorUnits(currency, i.Price, i.TotalPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	b = appendInt(b, 1, i.ChrtID)
+	b = appendString(b, 2, i.TrackNumber)
+	b = appendMajor(b, 3, i.Price)
+	b = appendString(b, 4, i.RID)
+	b = appendString(b, 5, i.Name)
+	b = appendInt(b, 6, int64(i.Sale))
+	b = appendString(b, 7, i.Size)
+	b = appendMajor(b, 8, i.TotalPrice)
+	b = appendInt(b, 9, i.NmID)
+	b = appendString(b, 10, i.Brand)
+	b = appendInt(b, 11, int64(i.Status))
+	b = appendInt(b, 12, minor[0])
+	b = appendInt(b, 13, minor[1])
+	return b, nil
+}
+
+// major читает сумму устаревшего поля в целых единицах валюты
+func major(typ protowire.Type, b []byte, dst *money.Amount) (int, error) {
+	var v int64
+	n, err := integer(typ, b, &v)
+	if err != nil {
+		return n, err
+	}
+	*dst, err = money.Major(v)
+	return n, err
+}
+
+// appendMajor пишет сумму в устаревшее поле, если она целая. Дробные суммы
+// передаются только полями *_minor
+func appendMajor(b []byte, num protowire.Number, a money.Amount) []byte {
+	if v, ok := a.Whole(); ok {
+		return appendInt(b, num, v)
+	}
+	return b
+}
+
+func minorUnits(typ protowire.Type, b []byte, dst **int64) (int, error) {
+	var v int64
+	n, err := integer(typ, b, &v)
+	*dst = &v
+	return n, err
+}
+
+// applyMinor заменяет суммы значениями из полей *_minor, если они пришли
+func applyMinor(currency money.Currency, minor []*int64, dst ...*money.Amount) error {
+	for i, v := range minor {
+		if v == nil {
+			continue
+		}
+		a, err := money.FromMinor(*v, currency)
+		if err != nil {
+			return err
+		}
+		*dst[i] = a
+	}
+
+	return nil
+}
+
+// decodeTimestamp читает google.protobuf.Timestamp, время приводится к UTC
+func decodeTimestamp(data []byte, t *time.Time) error {
+	var seconds, nanos int64
+	err := walk(data, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return integer(typ, b, &seconds)
+		case 2:
+			return integer(typ, b, &nanos)
+		}
+		return skip(num, typ, b)
+	})
+	if err != nil {
+		return err
+	}
+
+	*t = time.Unix(seconds, nanos).UTC()
+	return nil
+}
+
+func encodeTimestamp(t time.Time) []byte {
+	var b []byte
+	b = appendInt(b, 1, t.Unix())
+	b = appendInt(b, 2, int64(t.Nanosecond()))
+	return b
+}
+
+// walk обходит поля сообщения. fn возвращает число прочитанных байт значения поля
+func walk(data []byte, fn func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		n, err := fn(num, typ, data)
+		if err != nil {
+			return fmt.Errorf("field %d: %w", num, err)
+		}
+		data = data[n:]
+	}
+
+	return nil
+}
+
+func str(typ protowire.Type, b []byte, dst *string) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, fmt.Errorf("unexpected wire type %d for string", typ)
+	}
+
+	v, n := protowire.ConsumeString(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*dst = v
+
+	return n, nil
+}
+
+func integer[T int | int64](typ protowire.Type, b []byte, dst *T) (int, error) {
+	if typ != protowire.VarintType {
+		return 0, fmt.Errorf("unexpected wire type %d for integer", typ)
+	}
+
+	v, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+	*dst = T(int64(v))
+
+	return n, nil
+}
+
+func message(typ protowire.Type, b []byte, fn func([]byte) error) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, fmt.Errorf("unexpected wire type %d for message", typ)
+	}
+
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+
+	return n, fn(v)
+}
+
+// skip пропускает неизвестные поля, чтобы новые поля в .proto не ломали старых консюмеров
+func skip(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+	n := protowire.ConsumeFieldValue(num, typ, b)
+	if n < 0 {
+		return 0, protowire.ParseError(n)
+	}
+
+	return n, nil
+}
+
+// appendString и appendInt пропускают нулевые значения, как это делает proto3
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	if len(m) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
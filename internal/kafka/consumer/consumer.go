@@ -2,64 +2,312 @@ package consumer
 
 import (
 	"L0/internal/config"
+	"L0/internal/kafka/codec"
+	"L0/internal/kafka/headers"
+	"L0/internal/kafka/transport"
+	"L0/internal/lib/metrics"
 	"L0/internal/models"
 	"L0/internal/service"
+	"L0/internal/source"
 	"context"
-	"encoding/json"
-	"github.com/segmentio/kafka-go"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"sync"
+	"time"
 )
 
+// produceToStore измеряет время от записи сообщения в Kafka до сохранения заказа
+var produceToStore = metrics.NewHistogram("kafka_produce_to_store_latency", metrics.DefaultBuckets)
+
+var (
+	ErrUnsupportedEvent = errors.New("unsupported event type")
+	ErrMessageTooLarge  = errors.New("message exceeds size limit")
+)
+
+// Quarantine сохраняет сообщения, которые не удалось обработать, реализуется postgres.Storage
+type Quarantine interface {
+	Quarantine(ctx context.Context, msg models.QuarantinedMessage) error
+}
+
+// Политики обработки ошибок топика, см. config.Topic
+const (
+	onErrorSkip  = "skip"
+	onErrorRetry = "retry"
+	onErrorPause = "pause"
+)
+
+// Умолчания для настроек топика
+const (
+	defaultConcurrency  = 1
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = time.Second
+)
+
+// Пауза после ошибки чтения источника удваивается от fetchBackoff до maxFetchBackoff
+// и сбрасывается после успешного чтения
+const (
+	fetchBackoff    = 100 * time.Millisecond
+	maxFetchBackoff = 10 * time.Second
+)
+
+// Consumer читает все настроенные топики одной консюмер группой и дополнительные
+// источники из AddSource. Каждый источник обрабатывается своим конвейером с обработчиком
+// из реестра handlers, пауза и остановка общие
 type Consumer struct {
-	reader  *kafka.Reader
-	service *service.OrderService
+	service      *service.OrderService
+	codecs       *codec.Registry
+	decodingMode string
+	maxBytes     int64
+	groupID      string
+	log          *slog.Logger
+	quarantine   Quarantine
+	handlers     map[string]handlerFunc
+	pipelines    []*pipeline
+
+	mu           sync.Mutex
+	state        string
+	resumed      chan struct{}
+	runCtx       context.Context
+	active       context.Context
+	cancelActive context.CancelFunc
 }
 
-// NewConsumer создает новый консюмер кафки
-func NewConsumer(cfg config.Kafka, orderService *service.OrderService) *Consumer {
-	return &Consumer{
-		reader: kafka.NewReader(kafka.ReaderConfig{
-			Brokers:     cfg.Brokers,
-			Topic:       cfg.Topic,
-			GroupID:     cfg.GroupID,
-			StartOffset: kafka.LastOffset,
-			MaxBytes:    10e6,
-		}),
-		service: orderService,
+// NewConsumer создает консюмер для основного топика заказов и дополнительных топиков
+// событий из конфига. Формат тела сообщения выбирается по заголовку content-type,
+// а при его отсутствии берется из настроек. quarantine может быть nil, тогда
+// необработанные сообщения только логируются
+func NewConsumer(cfg config.Kafka, orderService *service.OrderService, codecs *codec.Registry, quarantine Quarantine, log *slog.Logger) (*Consumer, error) {
+	c := newConsumer(cfg, orderService, codecs, quarantine, log)
+
+	topics, err := topicsOf(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := transport.Dialer(cfg)
+	if err != nil {
+		return nil, err
 	}
+
+	for _, tc := range topics {
+		contentType := codec.ContentTypeJSON
+		if tc.Name == cfg.Topic && cfg.ContentType != "" {
+			contentType = cfg.ContentType
+		}
+
+		if err := c.AddSource(source.NewKafka(cfg, dialer, tc.Name), tc, contentType); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
 }
 
-// Run запускает консюмер
+// newConsumer создает консюмер с реестром обработчиков, но без источников
+func newConsumer(cfg config.Kafka, orderService *service.OrderService, codecs *codec.Registry, quarantine Quarantine, log *slog.Logger) *Consumer {
+	c := &Consumer{
+		service:      orderService,
+		codecs:       codecs,
+		decodingMode: cfg.Decoding.Mode,
+		maxBytes:     cfg.Decoding.MaxBytes,
+		groupID:      cfg.GroupID,
+		quarantine:   quarantine,
+		log:          log.With(slog.String("component", "kafka/consumer")),
+		state:        StateIdle,
+	}
+
+	c.handlers = map[string]handlerFunc{
+		headers.EventOrderCreated:       handler(c.decodeOrder, c.saveOrder),
+		headers.EventOrderStatusChanged: handler(decodeEvent[statusChanged](c.decodingMode), c.applyEvent),
+		headers.EventPaymentConfirmed:   handler(decodeEvent[paymentConfirmed](c.decodingMode), c.applyEvent),
+		headers.EventOrderCancelled:     handler(decodeEvent[orderCancelled](c.decodingMode), c.applyEvent),
+	}
+
+	return c
+}
+
+// AddSource подключает источник сообщений со своим обработчиком и политикой ошибок.
+// contentType используется для сообщений без заголовка content-type. Вызывается до Run
+func (c *Consumer) AddSource(src source.MessageSource, tc config.Topic, contentType string) error {
+	handle, ok := c.handlers[tc.Handler]
+	if !ok {
+		return fmt.Errorf("source %s: unknown handler %q", tc.Name, tc.Handler)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StateIdle {
+		return fmt.Errorf("source %s: consumer is already running", tc.Name)
+	}
+	for _, p := range c.pipelines {
+		if p.cfg.Name == tc.Name {
+			return fmt.Errorf("source %s is added twice", tc.Name)
+		}
+	}
+
+	c.pipelines = append(c.pipelines, newPipeline(c, src, withDefaults(tc), contentType, handle))
+
+	return nil
+}
+
+// topicsOf собирает основной топик заказов и дополнительные топики
+func topicsOf(cfg config.Kafka) ([]config.Topic, error) {
+	topics := []config.Topic{{Name: cfg.Topic, Handler: headers.EventOrderCreated}}
+	seen := make(map[string]bool, len(cfg.Topics))
+
+	for _, t := range cfg.Topics {
+		if seen[t.Name] {
+			return nil, fmt.Errorf("topic %s is configured twice", t.Name)
+		}
+		seen[t.Name] = true
+
+		if t.Name == cfg.Topic {
+			if t.Handler == "" {
+				t.Handler = topics[0].Handler
+			}
+			topics[0] = t
+			continue
+		}
+		topics = append(topics, t)
+	}
+
+	return topics, nil
+}
+
+// withDefaults заполняет незаданные настройки источника умолчаниями
+func withDefaults(t config.Topic) config.Topic {
+	if t.Concurrency <= 0 {
+		t.Concurrency = defaultConcurrency
+	}
+	if t.OnError == "" {
+		t.OnError = onErrorSkip
+	}
+	if t.MaxRetries <= 0 {
+		t.MaxRetries = defaultMaxRetries
+	}
+	if t.RetryBackoff <= 0 {
+		t.RetryBackoff = defaultRetryBackoff
+	}
+
+	return t
+}
+
+// Run запускает чтение всех источников и ждет их остановки по отмене ctx
 func (c *Consumer) Run(ctx context.Context, wg *sync.WaitGroup) {
 	defer wg.Done()
 
+	c.mu.Lock()
+	c.runCtx = ctx
+	c.active, c.cancelActive = context.WithCancel(ctx)
+	c.state = StateRunning
+	c.mu.Unlock()
+
+	var pipelines sync.WaitGroup
+	for _, p := range c.pipelines {
+		pipelines.Add(1)
+		go func(p *pipeline) {
+			defer pipelines.Done()
+			p.run(ctx)
+		}(p)
+	}
+
+	<-ctx.Done()
+	c.log.Info("stopping kafka consumer")
+	pipelines.Wait()
+
+	// Итог по источникам: после cmd/replay дубликаты показывают, сколько сообщений
+	// не изменили базу, потому что заказы и события уже были сохранены
+	for _, p := range c.pipelines {
+		st := p.snapshot()
+		c.log.Info("message source stopped",
+			slog.String("topic", st.Topic),
+			slog.Int64("processed", st.Processed),
+			slog.Int64("duplicates", st.Duplicates),
+			slog.Int64("failed", st.Failed),
+			slog.Int64("skipped", st.Skipped),
+		)
+	}
+
+	c.mu.Lock()
+	c.state = StateStopped
+	c.cancelActive()
+	c.mu.Unlock()
+}
+
+// Pause останавливает чтение новых сообщений во всех источниках, начатые сообщения
+// дообрабатываются. Участие в группе сохраняется, так что партиции не перебалансируются
+func (c *Consumer) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StateRunning {
+		return
+	}
+
+	c.state = StatePaused
+	c.resumed = make(chan struct{})
+	c.cancelActive()
+
+	c.log.Info("kafka consumer paused")
+}
+
+// Resume возобновляет чтение после Pause
+func (c *Consumer) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state != StatePaused {
+		return
+	}
+
+	c.state = StateRunning
+	c.active, c.cancelActive = context.WithCancel(c.runCtx)
+	close(c.resumed)
+
+	c.log.Info("kafka consumer resumed")
+}
+
+// Stats возвращает состояние консюмера, счетчики и смещения по партициям каждого источника
+func (c *Consumer) Stats() Stats {
+	c.mu.Lock()
+	st := Stats{
+		State:   c.state,
+		GroupID: c.groupID,
+		Topics:  make([]TopicStats, 0, len(c.pipelines)),
+	}
+	pipelines := c.pipelines
+	c.mu.Unlock()
+
+	for _, p := range pipelines {
+		st.Topics = append(st.Topics, p.snapshot())
+	}
+
+	return st
+}
+
+// waitResumed ждет снятия паузы и возвращает контекст для чтения, который Pause отменяет.
+// false означает, что консюмер пора останавливать
+func (c *Consumer) waitResumed(ctx context.Context) (context.Context, bool) {
 	for {
-		select {
-		case <-ctx.Done():
-			log.Println("stopping kafka consumer...")
-			if err := c.reader.Close(); err != nil {
-				log.Printf("failed to close kafka reader: %v", err)
-			}
-			return
-		default:
-			msg, err := c.reader.ReadMessage(ctx)
-			if err != nil {
-				log.Printf("kafka read error: %v", err)
-				continue
-			}
+		if ctx.Err() != nil {
+			return nil, false
+		}
 
-			var order models.Order
-			if err := json.Unmarshal(msg.Value, &order); err != nil {
-				log.Printf("failed to unmarshal order: %v", err)
-				continue
-			}
+		c.mu.Lock()
+		if c.state != StatePaused {
+			active := c.active
+			c.mu.Unlock()
+			return active, true
+		}
+		resumed := c.resumed
+		c.mu.Unlock()
 
-			if err := c.service.SaveOrder(&order); err != nil {
-				log.Printf("failed to save order: %v", err)
-			} else {
-				log.Printf("processed order: %s", order.OrderUID)
-			}
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-resumed:
 		}
 	}
 }
@@ -0,0 +1,220 @@
+package consumer
+
+import (
+	"L0/internal/kafka/codec"
+	"L0/internal/kafka/headers"
+	"L0/internal/lib/strictjson"
+	"L0/internal/models"
+	"L0/internal/service"
+	"L0/internal/source"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"time"
+)
+
+// handlerFunc обрабатывает сообщение топика, к которому привязан в реестре
+type handlerFunc func(ctx context.Context, log *slog.Logger, msg source.Message, meta headers.Metadata) error
+
+// handler собирает handlerFunc из декодера тела и обработчика результата.
+// Ошибки декодирования постоянные: повтор того же сообщения их не исправит.
+// log декодера уже содержит топик, смещение и trace_id сообщения
+func handler[T any](
+	decode func(log *slog.Logger, msg source.Message, meta headers.Metadata) (T, error),
+	handle func(ctx context.Context, log *slog.Logger, msg source.Message, v T) error,
+) handlerFunc {
+	return func(ctx context.Context, log *slog.Logger, msg source.Message, meta headers.Metadata) error {
+		v, err := decode(log, msg, meta)
+		if err != nil {
+			return permanent(err)
+		}
+
+		return handle(ctx, log, msg, v)
+	}
+}
+
+// errDuplicate сообщает, что заказ или событие уже сохранены. Сообщение подтверждается
+// без изменений в базе, так бывает при повторной обработке после cmd/replay
+var errDuplicate = errors.New("already processed")
+
+// permanentError помечает ошибку, при которой повторять обработку бесполезно
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// isPermanent сообщает, что сообщение не обработается и при повторе
+func isPermanent(err error) bool {
+	var (
+		permanentErr  *permanentError
+		validationErr *models.ValidationError
+	)
+
+	return errors.As(err, &permanentErr) || errors.As(err, &validationErr)
+}
+
+// Классы ошибок в карантине
+const (
+	errorClassTooLarge    = "too_large"
+	errorClassContentType = "unsupported_content_type"
+	errorClassValidation  = "validation"
+	errorClassDecode      = "decode"
+	errorClassProcessing  = "processing"
+)
+
+// errorClass относит ошибку обработки к классу, по которому поддержка фильтрует карантин
+func errorClass(err error) string {
+	var (
+		permanentErr  *permanentError
+		validationErr *models.ValidationError
+	)
+
+	switch {
+	case errors.Is(err, ErrMessageTooLarge):
+		return errorClassTooLarge
+	case errors.Is(err, codec.ErrUnsupportedContentType):
+		return errorClassContentType
+	case errors.As(err, &validationErr):
+		return errorClassValidation
+	case errors.As(err, &permanentErr):
+		return errorClassDecode
+	default:
+		return errorClassProcessing
+	}
+}
+
+// decodeOrder декодирует тело сообщения кодеком его формата с учетом версии схемы
+func (c *Consumer) decodeOrder(_ *slog.Logger, msg source.Message, meta headers.Metadata) (models.Order, error) {
+	dec, err := c.codecs.Lookup(meta.ContentType)
+	if err != nil {
+		return models.Order{}, err
+	}
+
+	return dec.Decode(msg.Value, meta.SchemaVersion)
+}
+
+func (c *Consumer) saveOrder(ctx context.Context, log *slog.Logger, msg source.Message, order models.Order) error {
+	if err := c.service.SaveOrder(ctx, &order); err != nil {
+		if errors.Is(err, service.ErrOrderExists) {
+			return fmt.Errorf("order %s: %w", order.OrderUID, errDuplicate)
+		}
+		return fmt.Errorf("failed to save order %s: %w", order.OrderUID, err)
+	}
+
+	// Задержку от записи в брокер знает только Kafka: у файлов Time является mtime,
+	// а у сообщений Channel может быть нулевым
+	if msg.Origin == source.OriginKafka && !msg.Time.IsZero() {
+		produceToStore.Observe(time.Since(msg.Time))
+	}
+	log.Info("processed order", slog.String("order_uid", order.OrderUID))
+	if len(order.Warnings) > 0 {
+		log.Warn("order amounts are inconsistent", slog.String("order_uid", order.OrderUID), slog.Any("warnings", order.Warnings))
+	}
+
+	return nil
+}
+
+// applyEvent применяет событие к заказу. Событие, пришедшее раньше самого заказа,
+// возвращает ошибку, чтобы политика retry дождалась его сохранения
+func (c *Consumer) applyEvent(ctx context.Context, log *slog.Logger, _ source.Message, event models.OrderEvent) error {
+	log = log.With(slog.String("order_uid", event.OrderUID), slog.String("status", event.Status))
+
+	if err := c.service.ApplyEvent(ctx, event); err != nil {
+		if errors.Is(err, service.ErrEventExists) {
+			return fmt.Errorf("%s for order %s: %w", event.Type, event.OrderUID, errDuplicate)
+		}
+		return fmt.Errorf("failed to apply %s to order %s: %w", event.Type, event.OrderUID, err)
+	}
+
+	log.Info("applied order event")
+
+	return nil
+}
+
+// eventPayload является телом события жизненного цикла заказа
+type eventPayload interface {
+	event() models.OrderEvent
+}
+
+// statusChanged является телом order.status_changed
+type statusChanged struct {
+	OrderUID  string    `json:"order_uid"`
+	Status    string    `json:"status"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+func (p statusChanged) event() models.OrderEvent {
+	return models.OrderEvent{
+		OrderUID:   p.OrderUID,
+		Type:       headers.EventOrderStatusChanged,
+		Status:     p.Status,
+		OccurredAt: p.ChangedAt,
+	}
+}
+
+// paymentConfirmed является телом payment.confirmed
+type paymentConfirmed struct {
+	OrderUID    string    `json:"order_uid"`
+	Transaction string    `json:"transaction"`
+	ConfirmedAt time.Time `json:"confirmed_at"`
+}
+
+func (p paymentConfirmed) event() models.OrderEvent {
+	return models.OrderEvent{
+		OrderUID:   p.OrderUID,
+		Type:       headers.EventPaymentConfirmed,
+		Status:     models.StatusPaid,
+		OccurredAt: p.ConfirmedAt,
+	}
+}
+
+// orderCancelled является телом order.cancelled
+type orderCancelled struct {
+	OrderUID    string    `json:"order_uid"`
+	Reason      string    `json:"reason"`
+	CancelledAt time.Time `json:"cancelled_at"`
+}
+
+func (p orderCancelled) event() models.OrderEvent {
+	return models.OrderEvent{
+		OrderUID:   p.OrderUID,
+		Type:       headers.EventOrderCancelled,
+		Status:     models.StatusCancelled,
+		OccurredAt: p.CancelledAt,
+	}
+}
+
+// decodeEvent возвращает декодер JSON события в режиме strictjson mode.
+// В режиме logged нарушения пишутся в лог. Исходное тело сохраняется в истории заказа
+func decodeEvent[T eventPayload](mode string) func(log *slog.Logger, msg source.Message, meta headers.Metadata) (models.OrderEvent, error) {
+	return func(log *slog.Logger, msg source.Message, meta headers.Metadata) (models.OrderEvent, error) {
+		if mediaType, _, _ := mime.ParseMediaType(meta.ContentType); mediaType != codec.ContentTypeJSON {
+			return models.OrderEvent{}, fmt.Errorf("%w: %s", codec.ErrUnsupportedContentType, meta.ContentType)
+		}
+
+		var payload T
+		problems, err := strictjson.Unmarshal(msg.Value, &payload, mode)
+		if err != nil {
+			return models.OrderEvent{}, err
+		}
+
+		event := payload.event()
+		if len(problems) > 0 {
+			log.Warn("accepted event with unexpected JSON",
+				slog.String("order_uid", event.OrderUID),
+				slog.Any("problems", problems),
+			)
+		}
+		event.Payload = msg.Value
+
+		return event, nil
+	}
+}
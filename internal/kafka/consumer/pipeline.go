@@ -0,0 +1,281 @@
+package consumer
+
+import (
+	"L0/internal/config"
+	"L0/internal/kafka/headers"
+	"L0/internal/lib/audit"
+	"L0/internal/lib/logger/sl"
+	"L0/internal/models"
+	"L0/internal/source"
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// pipeline обрабатывает сообщения одного источника: декодирует, валидирует, сохраняет
+// и подтверждает. Сообщения с одним ключом всегда попадают к одному воркеру, так что
+// события заказа не переупорядочиваются
+type pipeline struct {
+	consumer    *Consumer
+	cfg         config.Topic
+	contentType string
+	source      source.MessageSource
+	handle      handlerFunc
+	stats       *stats
+	log         *slog.Logger
+}
+
+func newPipeline(c *Consumer, src source.MessageSource, tc config.Topic, contentType string, handle handlerFunc) *pipeline {
+	return &pipeline{
+		consumer:    c,
+		cfg:         tc,
+		contentType: contentType,
+		source:      src,
+		handle:      handle,
+		stats:       newStats(),
+		log:         c.log.With(slog.String("topic", tc.Name), slog.String("handler", tc.Handler)),
+	}
+}
+
+// run читает источник до отмены ctx или его исчерпания. Обработанное сообщение
+// подтверждается Ack, прерванное остановкой возвращается источнику через Nack
+func (t *pipeline) run(ctx context.Context) {
+	queues := make([]chan source.Message, t.cfg.Concurrency)
+	var workers sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan source.Message)
+		workers.Add(1)
+		go func(queue <-chan source.Message) {
+			defer workers.Done()
+			for msg := range queue {
+				t.settle(ctx, msg, t.process(ctx, msg))
+			}
+		}(queues[i])
+	}
+
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		workers.Wait()
+
+		if err := t.source.Close(); err != nil {
+			t.log.Error("failed to close message source", sl.Err(err))
+		}
+	}()
+
+	backoff := fetchBackoff
+	for {
+		readCtx, ok := t.consumer.waitResumed(ctx)
+		if !ok {
+			return
+		}
+
+		msg, err := t.source.Fetch(readCtx)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				t.log.Info("message source is exhausted")
+				return
+			}
+			// Отмена чтения из-за паузы не теряет сообщение: источник выдаст его снова
+			if readCtx.Err() == nil {
+				t.log.Error("message source read error", sl.Err(err), slog.Duration("backoff", backoff))
+				t.stats.readError(err)
+				// Недоступный источник не опрашивается в цикле: пауза растет до maxFetchBackoff
+				sleep(readCtx, backoff)
+				backoff = min(2*backoff, maxFetchBackoff)
+			}
+			continue
+		}
+		backoff = fetchBackoff
+
+		queues[t.worker(msg)] <- msg
+	}
+}
+
+// worker выбирает воркера по ключу сообщения, а для сообщений без ключа по партиции
+func (t *pipeline) worker(msg source.Message) int {
+	if t.cfg.Concurrency == 1 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	if len(msg.Key) > 0 {
+		_, _ = h.Write(msg.Key)
+	} else {
+		_, _ = h.Write([]byte{byte(msg.Partition)})
+	}
+
+	return int(h.Sum32() % uint32(t.cfg.Concurrency))
+}
+
+// settle подтверждает сообщение источнику. Ошибки после остановки не логируются:
+// источник уже закрывается, а сообщение придет снова
+func (t *pipeline) settle(ctx context.Context, msg source.Message, handled bool) {
+	var err error
+	if handled {
+		err = t.source.Ack(ctx, msg)
+	} else {
+		err = t.source.Nack(ctx, msg)
+	}
+
+	if err != nil && ctx.Err() == nil {
+		t.log.Error("failed to settle message", sl.Err(err),
+			slog.Bool("ack", handled),
+			slog.String("source", msg.Source),
+			slog.Int("partition", msg.Partition),
+			slog.Int64("offset", msg.Offset),
+		)
+	}
+}
+
+// process обрабатывает сообщение по политике ошибок топика. false означает, что
+// обработку прервала остановка консюмера и подтверждать сообщение нельзя
+func (t *pipeline) process(ctx context.Context, msg source.Message) bool {
+	meta := headers.ParseMap(msg.Headers)
+	if meta.ContentType == "" {
+		meta.ContentType = t.contentType
+	}
+	if meta.EventType == "" {
+		meta.EventType = t.cfg.Handler
+	}
+	if meta.TraceID == "" {
+		meta.TraceID = headers.NewTraceID()
+	}
+
+	log := t.log.With(
+		slog.String("trace_id", meta.TraceID),
+		slog.String("event_type", meta.EventType),
+		slog.String("content_type", meta.ContentType),
+		slog.String("schema_version", meta.SchemaVersion),
+		slog.String("source_system", meta.SourceSystem),
+		slog.String("source", msg.Source),
+		slog.Int("partition", msg.Partition),
+		slog.Int64("offset", msg.Offset),
+	)
+
+	if maxBytes := t.consumer.maxBytes; maxBytes > 0 && int64(len(msg.Value)) > maxBytes {
+		log.Error("skipping message", sl.Err(ErrMessageTooLarge), slog.Int("size", len(msg.Value)))
+		t.stats.record(msg, outcomeFailed, ErrMessageTooLarge)
+		t.quarantine(ctx, log, msg, meta, ErrMessageTooLarge)
+		return true
+	}
+
+	// Топик привязан к одному обработчику, чужие события в нем пропускаются
+	if meta.EventType != t.cfg.Handler {
+		log.Warn("skipping message", sl.Err(ErrUnsupportedEvent))
+		t.stats.record(msg, outcomeSkipped, nil)
+		return true
+	}
+
+	ctx = audit.WithInfo(ctx, audit.Info{TraceID: meta.TraceID, SourceSystem: meta.SourceSystem})
+
+	for attempt := 1; ; attempt++ {
+		err := t.handle(ctx, log, msg, meta)
+		if err == nil {
+			t.stats.record(msg, outcomeProcessed, nil)
+			return true
+		}
+		if errors.Is(err, errDuplicate) {
+			duplicates := t.stats.record(msg, outcomeDuplicate, nil)
+			log.Info("skipping message", sl.Err(err), slog.Int64("duplicates", duplicates))
+			return true
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		if isPermanent(err) || t.cfg.OnError == onErrorSkip {
+			log.Error("failed to process message", sl.Err(err))
+			t.stats.record(msg, outcomeFailed, err)
+			t.quarantine(ctx, log, msg, meta, err)
+			return true
+		}
+
+		if attempt <= t.cfg.MaxRetries {
+			log.Warn("retrying message", sl.Err(err), slog.Int("attempt", attempt))
+			t.stats.retry(msg, err)
+			if !sleep(ctx, t.cfg.RetryBackoff*time.Duration(attempt)) {
+				return false
+			}
+			continue
+		}
+
+		if t.cfg.OnError == onErrorRetry {
+			log.Error("failed to process message after retries", sl.Err(err), slog.Int("attempts", attempt))
+			t.stats.record(msg, outcomeFailed, err)
+			t.quarantine(ctx, log, msg, meta, err)
+			return true
+		}
+
+		// onErrorPause: сообщение остается необработанным, пока оператор не вызовет resume
+		log.Error("pausing consumer after failed retries", sl.Err(err), slog.Int("attempts", attempt))
+		t.stats.retry(msg, err)
+		t.consumer.Pause()
+		if _, ok := t.consumer.waitResumed(ctx); !ok {
+			return false
+		}
+		attempt = 0
+	}
+}
+
+// quarantine сохраняет сообщение для разбора поддержкой, если карантин включен.
+// Ошибка карантина не задерживает подтверждение: сообщение остается в логе и статистике
+func (t *pipeline) quarantine(ctx context.Context, log *slog.Logger, msg source.Message, meta headers.Metadata, err error) {
+	if t.consumer.quarantine == nil {
+		return
+	}
+
+	hdrs := msg.Headers
+	if hdrs == nil {
+		hdrs = map[string]string{}
+	}
+
+	q := models.QuarantinedMessage{
+		Topic:         msg.Source,
+		Partition:     msg.Partition,
+		Offset:        msg.Offset,
+		Key:           string(msg.Key),
+		Headers:       hdrs,
+		EventType:     meta.EventType,
+		ContentType:   meta.ContentType,
+		SchemaVersion: meta.SchemaVersion,
+		Payload:       msg.Value,
+		ErrorClass:    errorClass(err),
+		ErrorMessage:  err.Error(),
+	}
+	if err := t.consumer.quarantine.Quarantine(ctx, q); err != nil {
+		log.Error("failed to quarantine message", sl.Err(err))
+		return
+	}
+
+	t.stats.quarantine()
+	log.Info("message quarantined", slog.String("error_class", q.ErrorClass))
+}
+
+func (t *pipeline) snapshot() TopicStats {
+	st := t.stats.snapshot()
+	st.Topic = t.cfg.Name
+	st.Handler = t.cfg.Handler
+	st.Concurrency = t.cfg.Concurrency
+	st.OnError = t.cfg.OnError
+
+	return st
+}
+
+// sleep ждет d или отмены ctx, false означает отмену
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
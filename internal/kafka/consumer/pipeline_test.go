@@ -0,0 +1,479 @@
+package consumer
+
+import (
+	"L0/internal/cache"
+	"L0/internal/config"
+	"L0/internal/kafka/codec"
+	"L0/internal/kafka/headers"
+	"L0/internal/lib/logger/handlers/slogdiscard"
+	"L0/internal/lib/strictjson"
+	"L0/internal/models"
+	"L0/internal/service"
+	"L0/internal/source"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errStorageDown = errors.New("storage is down")
+
+// flakyStorage отвечает errStorageDown на первые failures вызовов SaveOrder,
+// отрицательное failures означает ошибку на каждый вызов
+type flakyStorage struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	orders   map[string]models.Order
+}
+
+func newFlakyStorage(failures int) *flakyStorage {
+	return &flakyStorage{failures: failures, orders: map[string]models.Order{}}
+}
+
+func (s *flakyStorage) setFailures(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = n
+}
+
+func (s *flakyStorage) SaveOrder(_ context.Context, order models.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls++
+	if s.failures != 0 {
+		if s.failures > 0 {
+			s.failures--
+		}
+		return errStorageDown
+	}
+	if _, ok := s.orders[order.OrderUID]; ok {
+		return service.ErrOrderExists
+	}
+	s.orders[order.OrderUID] = order
+
+	return nil
+}
+
+func (s *flakyStorage) SaveOrders(ctx context.Context, orders []models.Order) []error {
+	errs := make([]error, len(orders))
+	for i, order := range orders {
+		errs[i] = s.SaveOrder(ctx, order)
+	}
+
+	return errs
+}
+
+func (s *flakyStorage) GetOrder(orderUID string) (*models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[orderUID]
+	if !ok {
+		return nil, service.ErrOrderNotFound
+	}
+
+	return &order, nil
+}
+
+func (s *flakyStorage) GetAllOrders() ([]models.Order, error) {
+	return nil, nil
+}
+
+func (s *flakyStorage) ApplyEvent(context.Context, models.OrderEvent) (string, error) {
+	return "", nil
+}
+
+func (s *flakyStorage) stats() (calls, saved int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls, len(s.orders)
+}
+
+// memQuarantine собирает сообщения карантина
+type memQuarantine struct {
+	mu   sync.Mutex
+	msgs []models.QuarantinedMessage
+}
+
+func (q *memQuarantine) Quarantine(_ context.Context, msg models.QuarantinedMessage) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.msgs = append(q.msgs, msg)
+
+	return nil
+}
+
+func (q *memQuarantine) messages() []models.QuarantinedMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append([]models.QuarantinedMessage(nil), q.msgs...)
+}
+
+func orderMessage(uid string, offset int64) source.Message {
+	return source.Message{
+		Source: "orders",
+		Offset: offset,
+		Key:    []byte(uid),
+		Value: []byte(fmt.Sprintf(`{"order_uid": %[1]q, "track_number": "WBILMTESTTRACK", "entry": "WBIL",
+			"delivery": {"name": "Test Testov", "phone": "+9720000000", "zip": "2639809", "city": "Kiryat Mozkin",
+				"address": "Ploshad Mira 15", "region": "Kraiot", "email": "test@gmail.com"},
+			"payment": {"transaction": %[1]q, "request_id": "", "currency": "RUB", "provider": "wbpay",
+				"amount": 1817, "payment_dt": 1637907727, "bank": "alpha", "delivery_cost": 1500,
+				"goods_total": 317, "custom_fee": 0},
+			"items": [], "locale": "en", "internal_signature": "", "customer_id": "test",
+			"delivery_service": "meest", "shardkey": "9", "sm_id": 99,
+			"date_created": "2021-11-26T06:22:19Z", "oof_shard": "1"}`, uid)),
+	}
+}
+
+// startConsumer запускает консюмер с единственным источником src и политикой tc
+func startConsumer(t *testing.T, storage *flakyStorage, quarantine Quarantine, src source.MessageSource, tc config.Topic) *Consumer {
+	t.Helper()
+
+	codecs, err := codec.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Kafka{Decoding: config.Decoding{Mode: strictjson.ModeStrict, MaxBytes: 1 << 20}}
+	c := newConsumer(cfg, service.New(storage, cache.New(), nil), codecs, quarantine, slogdiscard.NewDiscardLogger())
+
+	tc.Handler = headers.EventOrderCreated
+	if err := c.AddSource(src, tc, codec.ContentTypeJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go c.Run(ctx, &wg)
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	return c
+}
+
+// waitFor ждет выполнения cond, проверяя его каждые 5ms в течение пяти секунд
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func publish(t *testing.T, ch *source.Channel, msgs ...source.Message) {
+	t.Helper()
+
+	for _, msg := range msgs {
+		if err := ch.Publish(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func topicStats(c *Consumer) TopicStats {
+	return c.Stats().Topics[0]
+}
+
+func TestPipelineRetry(t *testing.T) {
+	storage := newFlakyStorage(2)
+	quarantine := &memQuarantine{}
+	ch := source.NewChannel(1)
+	c := startConsumer(t, storage, quarantine, ch, config.Topic{
+		Name: "orders", OnError: onErrorRetry, MaxRetries: 3, RetryBackoff: time.Millisecond,
+	})
+
+	publish(t, ch, orderMessage("retried", 1))
+	waitFor(t, "ack", func() bool { return len(ch.Acked()) == 1 })
+
+	if calls, saved := storage.stats(); calls != 3 || saved != 1 {
+		t.Errorf("SaveOrder calls = %d, saved = %d, want 3 and 1", calls, saved)
+	}
+	st := topicStats(c)
+	if st.Processed != 1 || st.Retries != 2 || st.Failed != 0 {
+		t.Errorf("stats processed=%d retries=%d failed=%d, want 1, 2, 0", st.Processed, st.Retries, st.Failed)
+	}
+	if n := len(quarantine.messages()); n != 0 {
+		t.Errorf("quarantined %d messages, want 0", n)
+	}
+	if n := len(ch.Nacked()); n != 0 {
+		t.Errorf("nacked %d messages, want 0", n)
+	}
+}
+
+func TestPipelineRetryExhausted(t *testing.T) {
+	storage := newFlakyStorage(-1)
+	quarantine := &memQuarantine{}
+	ch := source.NewChannel(1)
+	c := startConsumer(t, storage, quarantine, ch, config.Topic{
+		Name: "orders", OnError: onErrorRetry, MaxRetries: 2, RetryBackoff: time.Millisecond,
+	})
+
+	publish(t, ch, orderMessage("broken", 7))
+	waitFor(t, "ack", func() bool { return len(ch.Acked()) == 1 })
+
+	if calls, _ := storage.stats(); calls != 3 {
+		t.Errorf("SaveOrder calls = %d, want 3", calls)
+	}
+	st := topicStats(c)
+	if st.Failed != 1 || st.Retries != 2 || st.Quarantined != 1 {
+		t.Errorf("stats failed=%d retries=%d quarantined=%d, want 1, 2, 1", st.Failed, st.Retries, st.Quarantined)
+	}
+
+	msgs := quarantine.messages()
+	if len(msgs) != 1 {
+		t.Fatalf("quarantined %d messages, want 1", len(msgs))
+	}
+	q := msgs[0]
+	if q.Topic != "orders" || q.Offset != 7 || q.ErrorClass != errorClassProcessing || q.EventType != headers.EventOrderCreated {
+		t.Errorf("quarantined message %+v", q)
+	}
+}
+
+func TestPipelineSkip(t *testing.T) {
+	storage := newFlakyStorage(1)
+	quarantine := &memQuarantine{}
+	ch := source.NewChannel(4)
+	c := startConsumer(t, storage, quarantine, ch, config.Topic{
+		Name: "orders", OnError: onErrorSkip, MaxRetries: 3, RetryBackoff: time.Millisecond,
+	})
+
+	malformed := source.Message{Source: "orders", Offset: 2, Value: []byte(`{"order_uid": `)}
+	foreign := orderMessage("event", 3)
+	foreign.Headers = map[string]string{headers.EventType: headers.EventOrderCancelled}
+	publish(t, ch, orderMessage("skipped", 1), malformed, foreign, orderMessage("saved", 4))
+	waitFor(t, "acks", func() bool { return len(ch.Acked()) == 4 })
+
+	if calls, saved := storage.stats(); calls != 2 || saved != 1 {
+		t.Errorf("SaveOrder calls = %d, saved = %d, want 2 and 1", calls, saved)
+	}
+	st := topicStats(c)
+	if st.Processed != 1 || st.Failed != 2 || st.Skipped != 1 || st.Retries != 0 || st.Quarantined != 2 {
+		t.Errorf("stats processed=%d failed=%d skipped=%d retries=%d quarantined=%d, want 1, 2, 1, 0, 2",
+			st.Processed, st.Failed, st.Skipped, st.Retries, st.Quarantined)
+	}
+
+	classes := map[int64]string{}
+	for _, q := range quarantine.messages() {
+		classes[q.Offset] = q.ErrorClass
+	}
+	want := map[int64]string{1: errorClassProcessing, 2: errorClassDecode}
+	if fmt.Sprint(classes) != fmt.Sprint(want) {
+		t.Errorf("quarantined offsets and classes %v, want %v", classes, want)
+	}
+}
+
+func TestPipelinePause(t *testing.T) {
+	storage := newFlakyStorage(-1)
+	quarantine := &memQuarantine{}
+	ch := source.NewChannel(2)
+	c := startConsumer(t, storage, quarantine, ch, config.Topic{
+		Name: "orders", OnError: onErrorPause, MaxRetries: 1, RetryBackoff: time.Millisecond,
+	})
+
+	publish(t, ch, orderMessage("paused", 1), orderMessage("next", 2))
+	waitFor(t, "pause", func() bool { return c.Stats().State == StatePaused })
+
+	// На паузе следующее сообщение не читается, а застрявшее не подтверждается
+	time.Sleep(50 * time.Millisecond)
+	if calls, _ := storage.stats(); calls != 2 {
+		t.Errorf("SaveOrder calls on pause = %d, want 2", calls)
+	}
+	if n := len(ch.Acked()); n != 0 {
+		t.Fatalf("acked %d messages on pause, want 0", n)
+	}
+
+	storage.setFailures(0)
+	c.Resume()
+	waitFor(t, "acks", func() bool { return len(ch.Acked()) == 2 })
+
+	if _, saved := storage.stats(); saved != 2 {
+		t.Errorf("saved %d orders, want 2", saved)
+	}
+	if st := topicStats(c); st.Processed != 2 || st.Failed != 0 || st.Quarantined != 0 {
+		t.Errorf("stats processed=%d failed=%d quarantined=%d, want 2, 0, 0", st.Processed, st.Failed, st.Quarantined)
+	}
+	if n := len(quarantine.messages()); n != 0 {
+		t.Errorf("quarantined %d messages, want 0", n)
+	}
+}
+
+// TestPipelineDuplicates проверяет повторную обработку после перемотки: сохраненный заказ
+// подтверждается без карантина и учитывается дубликатом
+func TestPipelineDuplicates(t *testing.T) {
+	storage := newFlakyStorage(0)
+	quarantine := &memQuarantine{}
+	ch := source.NewChannel(3)
+	c := startConsumer(t, storage, quarantine, ch, config.Topic{Name: "orders", OnError: onErrorRetry, MaxRetries: 3})
+
+	publish(t, ch, orderMessage("replayed", 1), orderMessage("replayed", 1), orderMessage("replayed", 1))
+	waitFor(t, "acks", func() bool { return len(ch.Acked()) == 3 })
+
+	if calls, saved := storage.stats(); calls != 3 || saved != 1 {
+		t.Errorf("SaveOrder calls = %d, saved = %d, want 3 and 1", calls, saved)
+	}
+	st := topicStats(c)
+	if st.Processed != 1 || st.Duplicates != 2 || st.Failed != 0 || st.Retries != 0 {
+		t.Errorf("stats processed=%d duplicates=%d failed=%d retries=%d, want 1, 2, 0, 0",
+			st.Processed, st.Duplicates, st.Failed, st.Retries)
+	}
+	if n := len(quarantine.messages()); n != 0 {
+		t.Errorf("quarantined %d messages, want 0", n)
+	}
+}
+
+// failingSource отвечает ошибкой на каждый Fetch и считает вызовы
+type failingSource struct {
+	fetches atomic.Int64
+}
+
+func (s *failingSource) Fetch(context.Context) (source.Message, error) {
+	s.fetches.Add(1)
+	return source.Message{}, errors.New("broker is unavailable")
+}
+
+func (s *failingSource) Ack(context.Context, source.Message) error  { return nil }
+func (s *failingSource) Nack(context.Context, source.Message) error { return nil }
+func (s *failingSource) Close() error                               { return nil }
+
+func TestPipelineFetchBackoff(t *testing.T) {
+	src := &failingSource{}
+	c := startConsumer(t, newFlakyStorage(0), nil, src, config.Topic{Name: "orders"})
+
+	// Паузы 100ms, 200ms, 400ms: за полсекунды не больше четырех попыток
+	time.Sleep(500 * time.Millisecond)
+	if n := src.fetches.Load(); n < 2 || n > 4 {
+		t.Errorf("Fetch called %d times in 500ms, want 2..4", n)
+	}
+	if st := topicStats(c); st.ReadErrors < 2 {
+		t.Errorf("read errors = %d, want at least 2", st.ReadErrors)
+	}
+}
+
+// produceToStoreCount читает число наблюдений гистограммы задержки Kafka
+func produceToStoreCount(t *testing.T) uint64 {
+	t.Helper()
+
+	var v struct {
+		Count uint64 `json:"count"`
+	}
+	if err := json.Unmarshal([]byte(produceToStore.String()), &v); err != nil {
+		t.Fatal(err)
+	}
+
+	return v.Count
+}
+
+func TestProduceToStoreOnlyForKafka(t *testing.T) {
+	before := produceToStoreCount(t)
+
+	ch := source.NewChannel(3)
+	startConsumer(t, newFlakyStorage(0), nil, ch, config.Topic{Name: "orders"})
+
+	inbox := orderMessage("inbox", 1)
+	inbox.Origin, inbox.Time = source.OriginDir, time.Now().Add(-time.Hour)
+	kafka := orderMessage("kafka", 2)
+	kafka.Origin, kafka.Time = source.OriginKafka, time.Now()
+	publish(t, ch, orderMessage("channel", 0), inbox, kafka)
+	waitFor(t, "acks", func() bool { return len(ch.Acked()) == 3 })
+
+	if got := produceToStoreCount(t) - before; got != 1 {
+		t.Errorf("produce-to-store observations = %d, want 1 for the Kafka message", got)
+	}
+}
+
+// syncBuffer собирает лог воркеров конвейера
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
+
+// TestEventLoggedMode проверяет, что в режиме logged событие с неизвестным полем
+// применяется, а нарушение пишется в лог с топиком, смещением и trace_id
+func TestEventLoggedMode(t *testing.T) {
+	codecs, err := codec.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs syncBuffer
+	cfg := config.Kafka{Decoding: config.Decoding{Mode: strictjson.ModeLogged, MaxBytes: 1 << 20}}
+	c := newConsumer(cfg, service.New(newFlakyStorage(0), cache.New(), nil), codecs, nil, slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	ch := source.NewChannel(1)
+	tc := config.Topic{Name: "order-status", Handler: headers.EventOrderStatusChanged}
+	if err := c.AddSource(ch, tc, codec.ContentTypeJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go c.Run(ctx, &wg)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	publish(t, ch, source.Message{
+		Source:  "order-status",
+		Offset:  42,
+		Headers: map[string]string{headers.TraceID: "trace-1"},
+		Value:   []byte(`{"order_uid": "o-1", "status": "shipped", "changed_at": "2024-01-02T15:04:05Z", "courier": "x"}`),
+	})
+	waitFor(t, "ack", func() bool { return len(ch.Acked()) == 1 })
+
+	if st := topicStats(c); st.Processed != 1 {
+		t.Fatalf("processed = %d, want 1", st.Processed)
+	}
+
+	var entry map[string]any
+	for _, line := range strings.Split(logs.String(), "\n") {
+		if strings.Contains(line, "accepted event with unexpected JSON") {
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if entry == nil {
+		t.Fatalf("no warning about unexpected JSON in log:\n%s", logs.String())
+	}
+	if entry["topic"] != "order-status" || entry["offset"] != float64(42) || entry["trace_id"] != "trace-1" || entry["order_uid"] != "o-1" {
+		t.Errorf("warning attributes = %v", entry)
+	}
+	if problems := fmt.Sprint(entry["problems"]); !strings.Contains(problems, "courier") {
+		t.Errorf("problems = %s, want the unknown field", problems)
+	}
+}
@@ -0,0 +1,170 @@
+package consumer
+
+import (
+	"L0/internal/source"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Состояния консюмера
+const (
+	StateIdle    = "idle"
+	StateRunning = "running"
+	StatePaused  = "paused"
+	StateStopped = "stopped"
+)
+
+// Stats является снимком состояния консюмера для админского API
+type Stats struct {
+	State   string       `json:"state"`
+	GroupID string       `json:"group_id"`
+	Topics  []TopicStats `json:"topics"`
+}
+
+// TopicStats содержит настройки и счетчики одного топика
+type TopicStats struct {
+	Topic       string           `json:"topic"`
+	Handler     string           `json:"handler"`
+	Concurrency int              `json:"concurrency"`
+	OnError     string           `json:"on_error"`
+	Processed   int64            `json:"processed"`
+	Failed      int64            `json:"failed"`
+	Skipped     int64            `json:"skipped"`
+	Duplicates  int64            `json:"duplicates"`
+	Retries     int64            `json:"retries"`
+	Quarantined int64            `json:"quarantined"`
+	ReadErrors  int64            `json:"read_errors"`
+	LastError   *ErrorInfo       `json:"last_error,omitempty"`
+	Partitions  []PartitionStats `json:"partitions"`
+}
+
+// ErrorInfo описывает последнюю ошибку. Partition и Offset равны -1 для ошибок чтения
+type ErrorInfo struct {
+	Message   string    `json:"message"`
+	At        time.Time `json:"at"`
+	Partition int       `json:"partition"`
+	Offset    int64     `json:"offset"`
+}
+
+// PartitionStats показывает последнее обработанное смещение партиции. Lag считается
+// по high water mark на момент чтения сообщения, поэтому может отставать от брокера
+type PartitionStats struct {
+	Partition     int       `json:"partition"`
+	Offset        int64     `json:"offset"`
+	HighWaterMark int64     `json:"high_water_mark"`
+	Lag           int64     `json:"lag"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Исходы обработки сообщения
+const (
+	outcomeProcessed = iota
+	outcomeFailed
+	outcomeSkipped
+	// outcomeDuplicate означает, что заказ или событие уже были сохранены раньше
+	outcomeDuplicate
+)
+
+// stats накапливает счетчики консюмера, безопасен для конкурентного доступа
+type stats struct {
+	mu          sync.Mutex
+	processed   int64
+	failed      int64
+	skipped     int64
+	duplicates  int64
+	retries     int64
+	quarantined int64
+	readErrors  int64
+	lastError   *ErrorInfo
+	partitions  map[int]PartitionStats
+}
+
+func newStats() *stats {
+	return &stats{partitions: make(map[int]PartitionStats)}
+}
+
+// record учитывает исход обработки и возвращает число дубликатов с начала работы
+func (s *stats) record(msg source.Message, outcome int, err error) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch outcome {
+	case outcomeProcessed:
+		s.processed++
+	case outcomeFailed:
+		s.failed++
+	case outcomeSkipped:
+		s.skipped++
+	case outcomeDuplicate:
+		s.duplicates++
+	}
+	if err != nil {
+		s.lastError = &ErrorInfo{Message: err.Error(), At: time.Now(), Partition: msg.Partition, Offset: msg.Offset}
+	}
+
+	// Воркеры топика завершают сообщения не по порядку, смещение не должно идти назад
+	if prev, ok := s.partitions[msg.Partition]; ok && prev.Offset > msg.Offset {
+		return s.duplicates
+	}
+
+	s.partitions[msg.Partition] = PartitionStats{
+		Partition:     msg.Partition,
+		Offset:        msg.Offset,
+		HighWaterMark: msg.HighWaterMark,
+		Lag:           max(msg.HighWaterMark-msg.Offset-1, 0),
+		UpdatedAt:     time.Now(),
+	}
+
+	return s.duplicates
+}
+
+// retry учитывает повтор обработки, сообщение еще не считается обработанным
+func (s *stats) retry(msg source.Message, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.retries++
+	s.lastError = &ErrorInfo{Message: err.Error(), At: time.Now(), Partition: msg.Partition, Offset: msg.Offset}
+}
+
+func (s *stats) quarantine() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quarantined++
+}
+
+func (s *stats) readError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.readErrors++
+	s.lastError = &ErrorInfo{Message: err.Error(), At: time.Now(), Partition: -1, Offset: -1}
+}
+
+func (s *stats) snapshot() TopicStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := TopicStats{
+		Processed:   s.processed,
+		Failed:      s.failed,
+		Skipped:     s.skipped,
+		Duplicates:  s.duplicates,
+		Retries:     s.retries,
+		Quarantined: s.quarantined,
+		ReadErrors:  s.readErrors,
+		Partitions:  make([]PartitionStats, 0, len(s.partitions)),
+	}
+	if s.lastError != nil {
+		lastError := *s.lastError
+		st.LastError = &lastError
+	}
+	for _, p := range s.partitions {
+		st.Partitions = append(st.Partitions, p)
+	}
+	sort.Slice(st.Partitions, func(i, j int) bool { return st.Partitions[i].Partition < st.Partitions[j].Partition })
+
+	return st
+}
@@ -0,0 +1,121 @@
+package headers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Ключи заголовков сообщений, которые выставляет продюсер и читает консюмер
+const (
+	ContentType   = "content-type"
+	SchemaVersion = "schema-version"
+	TraceID       = "trace-id"
+	SourceSystem  = "source-system"
+	EventType     = "event-type"
+	SentAt        = "sent-at"
+)
+
+const (
+	ContentTypeJSON = "application/json"
+
+	EventOrderCreated       = "order.created"
+	EventOrderStatusChanged = "order.status_changed"
+	EventPaymentConfirmed   = "payment.confirmed"
+	EventOrderCancelled     = "order.cancelled"
+
+	// SchemaVersionCurrent является версией схемы, которую пишут наши продюсеры
+	SchemaVersionCurrent = "1"
+)
+
+// Metadata является разобранным набором заголовков сообщения
+type Metadata struct {
+	ContentType   string
+	SchemaVersion string
+	TraceID       string
+	SourceSystem  string
+	EventType     string
+	SentAt        time.Time
+}
+
+// Parse читает заголовки Kafka сообщения, см. ParseMap
+func Parse(hs []kafka.Header) Metadata {
+	return ParseMap(Map(hs))
+}
+
+// Map переводит заголовки Kafka в map. Пустые значения пропускаются, из повторов
+// остается последний
+func Map(hs []kafka.Header) map[string]string {
+	m := make(map[string]string, len(hs))
+	for _, h := range hs {
+		if len(h.Value) > 0 {
+			m[h.Key] = string(h.Value)
+		}
+	}
+
+	return m
+}
+
+// ParseMap читает заголовки сообщения любого источника. Сообщения старых продюсеров
+// без заголовков считаются сообщениями текущей схемы. ContentType и EventType остаются
+// пустыми, если заголовков нет, чтобы консюмер мог подставить значения из настроек топика
+func ParseMap(hs map[string]string) Metadata {
+	m := Metadata{
+		SchemaVersion: SchemaVersionCurrent,
+	}
+
+	for key, value := range hs {
+		if value == "" {
+			continue
+		}
+
+		switch key {
+		case ContentType:
+			m.ContentType = value
+		case SchemaVersion:
+			m.SchemaVersion = value
+		case TraceID:
+			m.TraceID = value
+		case SourceSystem:
+			m.SourceSystem = value
+		case EventType:
+			m.EventType = value
+		case SentAt:
+			if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				m.SentAt = t
+			}
+		}
+	}
+
+	return m
+}
+
+// Kafka собирает заголовки для отправки, пустые поля пропускаются
+func (m Metadata) Kafka() []kafka.Header {
+	hs := make([]kafka.Header, 0, 6)
+	add := func(key, value string) {
+		if value != "" {
+			hs = append(hs, kafka.Header{Key: key, Value: []byte(value)})
+		}
+	}
+
+	add(ContentType, m.ContentType)
+	add(SchemaVersion, m.SchemaVersion)
+	add(TraceID, m.TraceID)
+	add(SourceSystem, m.SourceSystem)
+	add(EventType, m.EventType)
+	if !m.SentAt.IsZero() {
+		add(SentAt, m.SentAt.Format(time.RFC3339Nano))
+	}
+
+	return hs
+}
+
+// NewTraceID генерирует случайный trace ID в формате W3C (32 hex символа)
+func NewTraceID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
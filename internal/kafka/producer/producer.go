@@ -0,0 +1,228 @@
+package producer
+
+import (
+	"L0/internal/config"
+	"L0/internal/kafka/headers"
+	"L0/internal/kafka/transport"
+	"L0/internal/lib/audit"
+	"L0/internal/models"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Delivery является результатом доставки одного сообщения
+type Delivery struct {
+	Key       string
+	TraceID   string
+	SentAt    time.Time
+	Partition int
+	Offset    int64
+	Err       error
+}
+
+// DeliveryFunc получает результат доставки каждого сообщения. Вызывается из горутин
+// kafka-go, поэтому должна быть безопасна для конкурентного вызова и не блокировать надолго
+type DeliveryFunc func(Delivery)
+
+// Producer публикует заказы в топик заказов по контракту сервиса: ключ order_uid,
+// чтобы все сообщения заказа попадали в одну партицию, и заголовки из internal/kafka/headers
+type Producer struct {
+	writer       *kafka.Writer
+	async        bool
+	sourceSystem string
+}
+
+// New создает продюсер для kafka.topic с настройками kafka.producer. sourceSystem попадает
+// в заголовок source-system, если в контексте нет audit.Info. onDelivery может быть nil
+func New(cfg config.Kafka, sourceSystem string, onDelivery DeliveryFunc) (*Producer, error) {
+	tr, err := transport.Transport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	compression, err := compressionOf(cfg.Producer.Compression)
+	if err != nil {
+		return nil, err
+	}
+	acks, err := requiredAcksOf(cfg.Producer.RequiredAcks)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Transport:    tr,
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		Compression:  compression,
+		RequiredAcks: acks,
+		MaxAttempts:  cfg.Producer.MaxAttempts,
+		BatchSize:    cfg.Producer.BatchSize,
+		BatchTimeout: cfg.Producer.BatchTimeout,
+		WriteTimeout: cfg.Producer.WriteTimeout,
+		Async:        cfg.Producer.Async,
+	}
+	if onDelivery != nil {
+		writer.Completion = func(messages []kafka.Message, err error) {
+			for _, msg := range messages {
+				meta := headers.Parse(msg.Headers)
+				onDelivery(Delivery{
+					Key:       string(msg.Key),
+					TraceID:   meta.TraceID,
+					SentAt:    meta.SentAt,
+					Partition: msg.Partition,
+					Offset:    msg.Offset,
+					Err:       err,
+				})
+			}
+		}
+	}
+
+	return &Producer{
+		writer:       writer,
+		async:        cfg.Producer.Async,
+		sourceSystem: sourceSystem,
+	}, nil
+}
+
+// PublishOrder публикует заказ в JSON текущей схемы. В синхронном режиме ждет подтверждения
+// брокера, в асинхронном возвращается сразу, а ошибка доставки приходит в DeliveryFunc
+func (p *Producer) PublishOrder(ctx context.Context, order models.Order) error {
+	return p.PublishOrders(ctx, []models.Order{order})[0]
+}
+
+// PublishOrders публикует пачку заказов одним вызовом и возвращает ошибку по каждому.
+// В асинхронном режиме возвращаются только ошибки до постановки в очередь, например
+// недоступность брокера при запросе метаданных, а ошибки доставки приходят в DeliveryFunc
+func (p *Producer) PublishOrders(ctx context.Context, orders []models.Order) []error {
+	errs := make([]error, len(orders))
+	msgs := make([]kafka.Message, 0, len(orders))
+	index := make([]int, 0, len(orders))
+
+	for i, order := range orders {
+		value, err := json.Marshal(order)
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to encode order %s: %w", order.OrderUID, err)
+			continue
+		}
+
+		msgs = append(msgs, p.message(ctx, order.OrderUID, value, headers.Metadata{
+			ContentType:   headers.ContentTypeJSON,
+			SchemaVersion: headers.SchemaVersionCurrent,
+			EventType:     headers.EventOrderCreated,
+		}))
+		index = append(index, i)
+	}
+	if len(msgs) == 0 {
+		return errs
+	}
+
+	for j, err := range p.write(ctx, msgs) {
+		errs[index[j]] = err
+	}
+
+	return errs
+}
+
+// Publish публикует готовое тело с ключом key. Незаданные поля meta заполняются
+// по контракту: JSON текущей схемы, событие order.created, trace ID и источник из контекста
+func (p *Producer) Publish(ctx context.Context, key string, value []byte, meta headers.Metadata) error {
+	if meta.ContentType == "" {
+		meta.ContentType = headers.ContentTypeJSON
+	}
+	if meta.SchemaVersion == "" {
+		meta.SchemaVersion = headers.SchemaVersionCurrent
+	}
+	if meta.EventType == "" {
+		meta.EventType = headers.EventOrderCreated
+	}
+
+	return p.write(ctx, []kafka.Message{p.message(ctx, key, value, meta)})[0]
+}
+
+// message дополняет заголовки trace ID, источником и временем отправки
+func (p *Producer) message(ctx context.Context, key string, value []byte, meta headers.Metadata) kafka.Message {
+	info := audit.FromContext(ctx)
+	if meta.TraceID == "" {
+		meta.TraceID = info.TraceID
+	}
+	if meta.TraceID == "" {
+		meta.TraceID = headers.NewTraceID()
+	}
+	if meta.SourceSystem == "" {
+		meta.SourceSystem = info.SourceSystem
+	}
+	if meta.SourceSystem == "" {
+		meta.SourceSystem = p.sourceSystem
+	}
+	if meta.SentAt.IsZero() {
+		meta.SentAt = time.Now()
+	}
+
+	return kafka.Message{Key: []byte(key), Value: value, Headers: meta.Kafka()}
+}
+
+// write отправляет сообщения и раскладывает ошибку kafka-go по сообщениям
+func (p *Producer) write(ctx context.Context, msgs []kafka.Message) []error {
+	errs := make([]error, len(msgs))
+
+	err := p.writer.WriteMessages(ctx, msgs...)
+
+	var writeErrs kafka.WriteErrors
+	switch {
+	case err == nil:
+	case errors.As(err, &writeErrs) && len(writeErrs) == len(msgs):
+		copy(errs, writeErrs)
+	default:
+		for i := range errs {
+			errs[i] = err
+		}
+	}
+
+	return errs
+}
+
+// Async сообщает, что публикация не ждет подтверждения брокера
+func (p *Producer) Async() bool {
+	return p.async
+}
+
+// Close дожидается отправки накопленных сообщений и закрывает соединения
+func (p *Producer) Close() error {
+	return p.writer.Close()
+}
+
+func compressionOf(name string) (kafka.Compression, error) {
+	switch name {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unsupported kafka compression %q", name)
+	}
+}
+
+func requiredAcksOf(name string) (kafka.RequiredAcks, error) {
+	switch name {
+	case "none":
+		return kafka.RequireNone, nil
+	case "one":
+		return kafka.RequireOne, nil
+	case "", "all":
+		return kafka.RequireAll, nil
+	default:
+		return 0, fmt.Errorf("unsupported kafka required acks %q", name)
+	}
+}
@@ -0,0 +1,302 @@
+package replay
+
+import (
+	"L0/internal/config"
+	"L0/internal/kafka/transport"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Позиции, на которые можно перемотать группу
+const (
+	PositionEarliest = "earliest"
+	PositionLatest   = "latest"
+	PositionTime     = "time"
+	PositionOffsets  = "offsets"
+)
+
+var ErrGroupActive = errors.New("consumer group has active members")
+
+// Target описывает, куда перемотать группу. Time используется для PositionTime,
+// Offsets для PositionOffsets: партиции без явного смещения не трогаются
+type Target struct {
+	Position string
+	Time     time.Time
+	Offsets  map[int]int64
+}
+
+// ParseTarget разбирает earliest, latest, время в RFC3339 или список partition:offset через запятую
+func ParseTarget(s string) (Target, error) {
+	switch s {
+	case PositionEarliest, PositionLatest:
+		return Target{Position: s}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return Target{Position: PositionTime, Time: t}, nil
+	}
+
+	offsets := make(map[int]int64)
+	for _, pair := range strings.Split(s, ",") {
+		p, o, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return Target{}, fmt.Errorf("invalid target %q: want earliest, latest, RFC3339 time or partition:offset list", s)
+		}
+		partition, err := strconv.Atoi(p)
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid partition %q: %w", p, err)
+		}
+		offset, err := strconv.ParseInt(o, 10, 64)
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid offset %q: %w", o, err)
+		}
+		offsets[partition] = offset
+	}
+
+	return Target{Position: PositionOffsets, Offsets: offsets}, nil
+}
+
+// Assignment показывает текущее и целевое смещение группы в одной партиции.
+// Committed равен -1, если группа еще ничего не коммитила
+type Assignment struct {
+	Partition int
+	First     int64
+	Last      int64
+	Committed int64
+	Target    int64
+}
+
+// Resetter перематывает смещения консюмер группы из конфига в одном топике
+type Resetter struct {
+	client *kafka.Client
+	topic  string
+	group  string
+}
+
+// New создает Resetter для топика topic и группы консюмера. Консюмер читает
+// все топики из cfg.TopicNames одной группой, каждый перематывается отдельно
+func New(cfg config.Kafka, topic string) (*Resetter, error) {
+	if !slices.Contains(cfg.TopicNames(), topic) {
+		return nil, fmt.Errorf("topic %s is not consumed by group %s, configured topics: %s",
+			topic, cfg.GroupID, strings.Join(cfg.TopicNames(), ", "))
+	}
+
+	tr, err := transport.Transport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Resetter{
+		client: &kafka.Client{Addr: kafka.TCP(cfg.Brokers...), Timeout: 10 * time.Second, Transport: tr},
+		topic:  topic,
+		group:  cfg.GroupID,
+	}, nil
+}
+
+// Topic возвращает перематываемый топик
+func (r *Resetter) Topic() string {
+	return r.topic
+}
+
+// Plan считает целевые смещения по партициям, ничего не меняя
+func (r *Resetter) Plan(ctx context.Context, target Target) ([]Assignment, error) {
+	partitions, err := r.partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	first, err := r.listOffsets(ctx, partitions, func(p int) kafka.OffsetRequest { return kafka.FirstOffsetOf(p) })
+	if err != nil {
+		return nil, err
+	}
+	last, err := r.listOffsets(ctx, partitions, func(p int) kafka.OffsetRequest { return kafka.LastOffsetOf(p) })
+	if err != nil {
+		return nil, err
+	}
+	committed, err := r.committed(ctx, partitions)
+	if err != nil {
+		return nil, err
+	}
+
+	var atTime map[int]int64
+	if target.Position == PositionTime {
+		atTime, err = r.listOffsets(ctx, partitions, func(p int) kafka.OffsetRequest { return kafka.TimeOffsetOf(p, target.Time) })
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plan := make([]Assignment, 0, len(partitions))
+	for _, p := range partitions {
+		a := Assignment{Partition: p, First: first[p], Last: last[p], Committed: committed[p]}
+
+		switch target.Position {
+		case PositionEarliest:
+			a.Target = a.First
+		case PositionLatest:
+			a.Target = a.Last
+		case PositionTime:
+			// Брокер возвращает -1, если после этого времени сообщений нет
+			a.Target = atTime[p]
+			if a.Target < 0 {
+				a.Target = a.Last
+			}
+		case PositionOffsets:
+			offset, ok := target.Offsets[p]
+			if !ok {
+				continue
+			}
+			if offset < a.First || offset > a.Last {
+				return nil, fmt.Errorf("offset %d is out of range [%d, %d] for partition %d", offset, a.First, a.Last, p)
+			}
+			a.Target = offset
+		default:
+			return nil, fmt.Errorf("unknown position %q", target.Position)
+		}
+
+		plan = append(plan, a)
+	}
+
+	for p := range target.Offsets {
+		if _, ok := first[p]; !ok {
+			return nil, fmt.Errorf("partition %d does not exist in topic %s", p, r.topic)
+		}
+	}
+
+	return plan, nil
+}
+
+// Apply коммитит целевые смещения от имени группы. Коммит вне поколения группы брокер
+// принимает только когда в ней нет участников, поэтому консюмеры нужно остановить заранее
+func (r *Resetter) Apply(ctx context.Context, plan []Assignment) error {
+	groups, err := r.client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{r.group}})
+	if err != nil {
+		return fmt.Errorf("failed to describe group %s: %w", r.group, err)
+	}
+	for _, g := range groups.Groups {
+		if g.Error != nil {
+			return fmt.Errorf("failed to describe group %s: %w", r.group, g.Error)
+		}
+		if len(g.Members) > 0 {
+			return fmt.Errorf("%w: %s has %d members in state %s", ErrGroupActive, r.group, len(g.Members), g.GroupState)
+		}
+	}
+
+	commits := make([]kafka.OffsetCommit, len(plan))
+	for i, a := range plan {
+		commits[i] = kafka.OffsetCommit{Partition: a.Partition, Offset: a.Target}
+	}
+
+	resp, err := r.client.OffsetCommit(ctx, &kafka.OffsetCommitRequest{
+		GroupID:      r.group,
+		GenerationID: -1,
+		Topics:       map[string][]kafka.OffsetCommit{r.topic: commits},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit offsets: %w", err)
+	}
+
+	for _, p := range resp.Topics[r.topic] {
+		if p.Error != nil {
+			return fmt.Errorf("failed to commit offset for partition %d: %w", p.Partition, p.Error)
+		}
+	}
+
+	return nil
+}
+
+func (r *Resetter) partitions(ctx context.Context) ([]int, error) {
+	meta, err := r.client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{r.topic}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get metadata: %w", err)
+	}
+
+	for _, t := range meta.Topics {
+		if t.Name != r.topic {
+			continue
+		}
+		if t.Error != nil {
+			return nil, fmt.Errorf("failed to get metadata for topic %s: %w", r.topic, t.Error)
+		}
+
+		partitions := make([]int, len(t.Partitions))
+		for i, p := range t.Partitions {
+			partitions[i] = p.ID
+		}
+		sort.Ints(partitions)
+
+		return partitions, nil
+	}
+
+	return nil, fmt.Errorf("topic %s not found", r.topic)
+}
+
+// listOffsets запрашивает по одному смещению на партицию. Запросы разных видов
+// идут отдельными вызовами: брокер не принимает одну партицию дважды в запросе
+func (r *Resetter) listOffsets(ctx context.Context, partitions []int, req func(int) kafka.OffsetRequest) (map[int]int64, error) {
+	requests := make([]kafka.OffsetRequest, len(partitions))
+	for i, p := range partitions {
+		requests[i] = req(p)
+	}
+
+	resp, err := r.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{r.topic: requests},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets: %w", err)
+	}
+
+	offsets := make(map[int]int64, len(partitions))
+	for _, p := range resp.Topics[r.topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to list offsets for partition %d: %w", p.Partition, p.Error)
+		}
+
+		// kafka-go раскладывает ответ по полям на основе timestamp из ответа брокера.
+		// На earliest и latest брокер отвечает timestamp -1, поэтому оба попадают в LastOffset,
+		// а не найденное по времени смещение приходит как LastOffset = -1
+		switch {
+		case len(p.Offsets) > 0:
+			for offset := range p.Offsets {
+				offsets[p.Partition] = offset
+			}
+		case p.LastOffset >= 0:
+			offsets[p.Partition] = p.LastOffset
+		default:
+			offsets[p.Partition] = -1
+		}
+	}
+
+	return offsets, nil
+}
+
+func (r *Resetter) committed(ctx context.Context, partitions []int) (map[int]int64, error) {
+	resp, err := r.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{
+		GroupID: r.group,
+		Topics:  map[string][]int{r.topic: partitions},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("failed to fetch committed offsets: %w", resp.Error)
+	}
+
+	committed := make(map[int]int64, len(partitions))
+	for _, p := range resp.Topics[r.topic] {
+		if p.Error != nil {
+			return nil, fmt.Errorf("failed to fetch committed offset for partition %d: %w", p.Partition, p.Error)
+		}
+		committed[p.Partition] = p.CommittedOffset
+	}
+
+	return committed, nil
+}
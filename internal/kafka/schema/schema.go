@@ -0,0 +1,66 @@
+package schema
+
+import (
+	"L0/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Версии схемы заказа в заголовке schema-version
+const (
+	V1 = "1"
+	V2 = "2"
+)
+
+var ErrUnknownVersion = errors.New("unknown schema version")
+
+// Unmarshaler разбирает JSON документ в v, например json.Unmarshal
+type Unmarshaler func(data []byte, v any) error
+
+// decoder декодирует тело сообщения своей версии и поднимает его до последней версии схемы
+type decoder func(data []byte, unmarshal Unmarshaler) (OrderV2, error)
+
+// decoders связывает версию схемы с ее декодером. Новая версия добавляется сюда вместе
+// с апкастером из предыдущей
+var decoders = map[string]decoder{
+	V1: func(data []byte, unmarshal Unmarshaler) (OrderV2, error) {
+		v1, err := decodeV1(data, unmarshal)
+		if err != nil {
+			return OrderV2{}, err
+		}
+		return upcastV1(v1)
+	},
+	V2: decodeV2,
+}
+
+// Decode декодирует заказ указанной версии схемы в доменную модель
+func Decode(version string, data []byte) (models.Order, error) {
+	return DecodeWith(version, data, json.Unmarshal)
+}
+
+// DecodeWith работает как Decode, но разбирает JSON переданной функцией
+func DecodeWith(version string, data []byte, unmarshal Unmarshaler) (models.Order, error) {
+	decode, ok := decoders[version]
+	if !ok {
+		return models.Order{}, fmt.Errorf("%w: %q", ErrUnknownVersion, version)
+	}
+
+	latest, err := decode(data, unmarshal)
+	if err != nil {
+		return models.Order{}, fmt.Errorf("schema v%s: %w", version, err)
+	}
+
+	order, err := toDomain(latest)
+	if err != nil {
+		return models.Order{}, fmt.Errorf("schema v%s: %w", version, err)
+	}
+
+	return order, nil
+}
+
+// Supported сообщает, известна ли версия схемы
+func Supported(version string) bool {
+	_, ok := decoders[version]
+	return ok
+}
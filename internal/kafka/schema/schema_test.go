@@ -0,0 +1,72 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update перезаписывает эталоны: go test ./internal/kafka/schema -update
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// TestGolden декодирует каждый testdata/v<версия>/<имя>.json своей версией схемы и сравнивает
+// результат с <имя>.golden: models.Order в JSON или текст ошибки после "error: "
+func TestGolden(t *testing.T) {
+	for _, version := range []string{V1, V2} {
+		files, err := filepath.Glob(filepath.Join("testdata", "v"+version, "*.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) == 0 {
+			t.Fatalf("no golden inputs for schema v%s", version)
+		}
+
+		for _, file := range files {
+			name := strings.TrimSuffix(file, ".json")
+			t.Run(filepath.Join("v"+version, filepath.Base(name)), func(t *testing.T) {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got := decodeGolden(t, version, data)
+
+				golden := name + ".golden"
+				if *update {
+					if err := os.WriteFile(golden, got, 0o644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("missing golden file, run with -update: %v", err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s differs from golden file\n got: %s\nwant: %s", file, got, want)
+				}
+			})
+		}
+	}
+}
+
+func decodeGolden(t *testing.T, version string, data []byte) []byte {
+	t.Helper()
+
+	order, err := Decode(version, data)
+	if err != nil {
+		return []byte("error: " + err.Error() + "\n")
+	}
+
+	got, err := json.MarshalIndent(order, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(got, '\n')
+}
@@ -0,0 +1,140 @@
+package schema
+
+import (
+	"L0/internal/lib/money"
+	"fmt"
+	"time"
+)
+
+// OrderV1 является исходным форматом: одна оплата, суммы в единицах валюты.
+// Изначально суммы были целыми, дробная часть допускается до минорной единицы валюты
+type OrderV1 struct {
+	OrderUID          string     `json:"order_uid"`
+	TrackNumber       string     `json:"track_number"`
+	Entry             string     `json:"entry"`
+	Delivery          DeliveryV1 `json:"delivery"`
+	Payment           PaymentV1  `json:"payment"`
+	Items             []ItemV1   `json:"items"`
+	Locale            string     `json:"locale"`
+	InternalSignature string     `json:"internal_signature"`
+	CustomerID        string     `json:"customer_id"`
+	DeliveryService   string     `json:"delivery_service"`
+	Shardkey          string     `json:"shardkey"`
+	SmID              int        `json:"sm_id"`
+	DateCreated       time.Time  `json:"date_created"`
+	OofShard          string     `json:"oof_shard"`
+}
+
+type DeliveryV1 struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Zip     string `json:"zip"`
+	City    string `json:"city"`
+	Address string `json:"address"`
+	Region  string `json:"region"`
+	Email   string `json:"email"`
+}
+
+type PaymentV1 struct {
+	Transaction  string       `json:"transaction"`
+	RequestID    string       `json:"request_id"`
+	Currency     string       `json:"currency"`
+	Provider     string       `json:"provider"`
+	Amount       money.Amount `json:"amount"`
+	PaymentDT    int64        `json:"payment_dt"`
+	Bank         string       `json:"bank"`
+	DeliveryCost money.Amount `json:"delivery_cost"`
+	GoodsTotal   money.Amount `json:"goods_total"`
+	CustomFee    money.Amount `json:"custom_fee"`
+}
+
+type ItemV1 struct {
+	ChrtID      int64        `json:"chrt_id"`
+	TrackNumber string       `json:"track_number"`
+	Price       money.Amount `json:"price"`
+	RID         string       `json:"rid"`
+	Name        string       `json:"name"`
+	Sale        int          `json:"sale"`
+	Size        string       `json:"size"`
+	TotalPrice  money.Amount `json:"total_price"`
+	NmID        int64        `json:"nm_id"`
+	Brand       string       `json:"brand"`
+	Status      int          `json:"status"`
+}
+
+func decodeV1(data []byte, unmarshal Unmarshaler) (OrderV1, error) {
+	var order OrderV1
+	err := unmarshal(data, &order)
+	return order, err
+}
+
+// upcastV1 переводит суммы в минорные единицы валюты и заворачивает оплату в список
+func upcastV1(v1 OrderV1) (OrderV2, error) {
+	p := v1.Payment
+	currency := money.CurrencyOf(p.Currency)
+
+	var err error
+	minor := func(field string, a money.Amount) int64 {
+		if err != nil {
+			return 0
+		}
+		v, convErr := a.Minor(currency)
+		if convErr != nil {
+			err = fmt.Errorf("%s: %w", field, convErr)
+		}
+		return v
+	}
+
+	var items []ItemV2
+	if v1.Items != nil {
+		items = make([]ItemV2, len(v1.Items))
+	}
+	for i, item := range v1.Items {
+		items[i] = ItemV2{
+			ChrtID:          item.ChrtID,
+			TrackNumber:     item.TrackNumber,
+			PriceMinor:      minor(fmt.Sprintf("items[%d].price", i), item.Price),
+			RID:             item.RID,
+			Name:            item.Name,
+			Sale:            item.Sale,
+			Size:            item.Size,
+			TotalPriceMinor: minor(fmt.Sprintf("items[%d].total_price", i), item.TotalPrice),
+			NmID:            item.NmID,
+			Brand:           item.Brand,
+			Status:          item.Status,
+		}
+	}
+
+	payment := PaymentV2{
+		Transaction:       p.Transaction,
+		RequestID:         p.RequestID,
+		Currency:          p.Currency,
+		Provider:          p.Provider,
+		AmountMinor:       minor("payment.amount", p.Amount),
+		PaymentDT:         p.PaymentDT,
+		Bank:              p.Bank,
+		DeliveryCostMinor: minor("payment.delivery_cost", p.DeliveryCost),
+		GoodsTotalMinor:   minor("payment.goods_total", p.GoodsTotal),
+		CustomFeeMinor:    minor("payment.custom_fee", p.CustomFee),
+	}
+	if err != nil {
+		return OrderV2{}, err
+	}
+
+	return OrderV2{
+		OrderUID:          v1.OrderUID,
+		TrackNumber:       v1.TrackNumber,
+		Entry:             v1.Entry,
+		Delivery:          DeliveryV2(v1.Delivery),
+		Payments:          []PaymentV2{payment},
+		Items:             items,
+		Locale:            v1.Locale,
+		InternalSignature: v1.InternalSignature,
+		CustomerID:        v1.CustomerID,
+		DeliveryService:   v1.DeliveryService,
+		Shardkey:          v1.Shardkey,
+		SmID:              v1.SmID,
+		DateCreated:       v1.DateCreated,
+		OofShard:          v1.OofShard,
+	}, nil
+}
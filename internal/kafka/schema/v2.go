@@ -0,0 +1,159 @@
+package schema
+
+import (
+	"L0/internal/lib/money"
+	"L0/internal/models"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OrderV2 хранит суммы в минорных единицах валюты ISO 4217 и допускает несколько оплат на заказ
+type OrderV2 struct {
+	OrderUID          string      `json:"order_uid"`
+	TrackNumber       string      `json:"track_number"`
+	Entry             string      `json:"entry"`
+	Delivery          DeliveryV2  `json:"delivery"`
+	Payments          []PaymentV2 `json:"payments"`
+	Items             []ItemV2    `json:"items"`
+	Locale            string      `json:"locale"`
+	InternalSignature string      `json:"internal_signature"`
+	CustomerID        string      `json:"customer_id"`
+	DeliveryService   string      `json:"delivery_service"`
+	Shardkey          string      `json:"shardkey"`
+	SmID              int         `json:"sm_id"`
+	DateCreated       time.Time   `json:"date_created"`
+	OofShard          string      `json:"oof_shard"`
+}
+
+type DeliveryV2 struct {
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Zip     string `json:"zip"`
+	City    string `json:"city"`
+	Address string `json:"address"`
+	Region  string `json:"region"`
+	Email   string `json:"email"`
+}
+
+type PaymentV2 struct {
+	Transaction       string `json:"transaction"`
+	RequestID         string `json:"request_id"`
+	Currency          string `json:"currency"`
+	Provider          string `json:"provider"`
+	AmountMinor       int64  `json:"amount_minor"`
+	PaymentDT         int64  `json:"payment_dt"`
+	Bank              string `json:"bank"`
+	DeliveryCostMinor int64  `json:"delivery_cost_minor"`
+	GoodsTotalMinor   int64  `json:"goods_total_minor"`
+	CustomFeeMinor    int64  `json:"custom_fee_minor"`
+}
+
+type ItemV2 struct {
+	ChrtID          int64  `json:"chrt_id"`
+	TrackNumber     string `json:"track_number"`
+	PriceMinor      int64  `json:"price_minor"`
+	RID             string `json:"rid"`
+	Name            string `json:"name"`
+	Sale            int    `json:"sale"`
+	Size            string `json:"size"`
+	TotalPriceMinor int64  `json:"total_price_minor"`
+	NmID            int64  `json:"nm_id"`
+	Brand           string `json:"brand"`
+	Status          int    `json:"status"`
+}
+
+var (
+	ErrNoPayments      = errors.New("order has no payments")
+	ErrMixedCurrencies = errors.New("payments have different currencies")
+)
+
+func decodeV2(data []byte, unmarshal Unmarshaler) (OrderV2, error) {
+	var order OrderV2
+	err := unmarshal(data, &order)
+	return order, err
+}
+
+// toDomain переводит последнюю версию схемы в доменную модель. Оплаты в одной валюте
+// сворачиваются в одну: реквизиты берутся из первой, суммы складываются
+func toDomain(v2 OrderV2) (models.Order, error) {
+	if len(v2.Payments) == 0 {
+		return models.Order{}, ErrNoPayments
+	}
+
+	first := v2.Payments[0]
+	currency := money.CurrencyOf(first.Currency)
+
+	// Суммы складываются уже в money.Amount: сложение минорных единиц могло бы переполниться незаметно
+	var totals [4]money.Amount
+	for i, p := range v2.Payments {
+		if p.Currency != first.Currency {
+			return models.Order{}, fmt.Errorf("%w: %s and %s", ErrMixedCurrencies, first.Currency, p.Currency)
+		}
+
+		var amounts [4]money.Amount
+		err := money.FromMinorUnits(currency, []int64{p.AmountMinor, p.DeliveryCostMinor, p.GoodsTotalMinor, p.CustomFeeMinor},
+			&amounts[0], &amounts[1], &amounts[2], &amounts[3])
+		if err != nil {
+			return models.Order{}, fmt.Errorf("payments[%d]: %w", i, err)
+		}
+		for j := range totals {
+			if totals[j], err = money.Sum(totals[j], amounts[j]); err != nil {
+				return models.Order{}, fmt.Errorf("payment: %w", err)
+			}
+		}
+	}
+
+	payment := models.Payment{
+		Transaction:  first.Transaction,
+		RequestID:    first.RequestID,
+		Currency:     first.Currency,
+		Provider:     first.Provider,
+		PaymentDT:    first.PaymentDT,
+		Bank:         first.Bank,
+		Amount:       totals[0],
+		DeliveryCost: totals[1],
+		GoodsTotal:   totals[2],
+		CustomFee:    totals[3],
+	}
+
+	var items []models.Item
+	if v2.Items != nil {
+		items = make([]models.Item, len(v2.Items))
+	}
+	for i, item := range v2.Items {
+		items[i] = models.Item{
+			ChrtID:      item.ChrtID,
+			TrackNumber: item.TrackNumber,
+			RID:         item.RID,
+			Name:        item.Name,
+			Sale:        item.Sale,
+			Size:        item.Size,
+			NmID:        item.NmID,
+			Brand:       item.Brand,
+			Status:      item.Status,
+		}
+		err := money.FromMinorUnits(currency, []int64{item.PriceMinor, item.TotalPriceMinor},
+			&items[i].Price, &items[i].TotalPrice)
+		if err != nil {
+			return models.Order{}, fmt.Errorf("items[%d]: %w", i, err)
+		}
+	}
+
+	return models.Order{
+		OrderUID:          v2.OrderUID,
+		TrackNumber:       v2.TrackNumber,
+		Entry:             v2.Entry,
+		Delivery:          models.Delivery(v2.Delivery),
+		Payment:           payment,
+		Items:             items,
+		Locale:            v2.Locale,
+		InternalSignature: v2.InternalSignature,
+		CustomerID:        v2.CustomerID,
+		DeliveryService:   v2.DeliveryService,
+		Shardkey:          v2.Shardkey,
+		SmID:              v2.SmID,
+		DateCreated:       v2.DateCreated,
+		OofShard:          v2.OofShard,
+	}, nil
+}
@@ -0,0 +1,130 @@
+package transport
+
+import (
+	"L0/internal/config"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// dialTimeout ограничивает установку соединения с брокером вместе с TLS и SASL
+const dialTimeout = 10 * time.Second
+
+// Dialer создает dialer для kafka.Reader с TLS и SASL из конфига
+func Dialer(cfg config.Kafka) (*kafka.Dialer, error) {
+	tlsConfig, mechanism, err := security(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Dialer{
+		Timeout:       dialTimeout,
+		DualStack:     true,
+		TLS:           tlsConfig,
+		SASLMechanism: mechanism,
+	}, nil
+}
+
+// Transport создает транспорт для kafka.Writer и kafka.Client с теми же настройками, что Dialer
+func Transport(cfg config.Kafka) (*kafka.Transport, error) {
+	tlsConfig, mechanism, err := security(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kafka.Transport{
+		DialTimeout: dialTimeout,
+		TLS:         tlsConfig,
+		SASL:        mechanism,
+	}, nil
+}
+
+func security(cfg config.Kafka) (*tls.Config, sasl.Mechanism, error) {
+	tlsConfig, err := TLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mechanism, err := Mechanism(cfg.SASL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tlsConfig, mechanism, nil
+}
+
+// TLSConfig собирает TLS конфиг клиента. Возвращает nil, если TLS выключен.
+// ServerName не задается: kafka-go подставляет хост брокера сам
+func TLSConfig(cfg config.KafkaTLS) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kafka CA file: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in kafka CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		if cfg.CertFile == "" || cfg.KeyFile == "" {
+			return nil, errors.New("kafka client certificate requires both cert and key files")
+		}
+
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kafka client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// Mechanism создает SASL механизм из конфига. Возвращает nil, если SASL выключен
+func Mechanism(cfg config.KafkaSASL) (sasl.Mechanism, error) {
+	switch cfg.Mechanism {
+	case "":
+		return nil, nil
+	case config.SASLPlain:
+		return plain.Mechanism{Username: cfg.Username, Password: cfg.Password}, nil
+	case config.SASLScramSHA256:
+		return scramMechanism(scram.SHA256, cfg)
+	case config.SASLScramSHA512:
+		return scramMechanism(scram.SHA512, cfg)
+	default:
+		return nil, fmt.Errorf("unsupported kafka SASL mechanism %q", cfg.Mechanism)
+	}
+}
+
+func scramMechanism(algo scram.Algorithm, cfg config.KafkaSASL) (sasl.Mechanism, error) {
+	mechanism, err := scram.Mechanism(algo, cfg.Username, cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init kafka %s: %w", cfg.Mechanism, err)
+	}
+
+	return mechanism, nil
+}
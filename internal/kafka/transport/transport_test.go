@@ -0,0 +1,298 @@
+package transport
+
+import (
+	"L0/internal/config"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA является локальным удостоверяющим центром для тестов
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+
+	key := newKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, name+".pem")
+	writePEM(t, file, "CERTIFICATE", der)
+
+	return &testCA{cert: cert, key: key, file: file}
+}
+
+// issue выпускает сертификат сервера для localhost или клиента и пишет его с ключом в dir
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	t.Helper()
+
+	key := newKey(t)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+
+	return certFile, keyFile
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writePEM(t *testing.T, file, typ string, der []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// startBroker запускает TLS сервер, который требует клиентский сертификат от ca
+// и отвечает "ok" после успешного рукопожатия
+func startBroker(t *testing.T, ca *testCA, certFile, keyFile string) string {
+	t.Helper()
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clients := x509.NewCertPool()
+	clients.AddCert(ca.cert)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    clients,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if err := conn.(*tls.Conn).Handshake(); err != nil {
+					return
+				}
+				_, _ = conn.Write([]byte("ok"))
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// dial подключается так же, как kafka-go: с конфигом TLSConfig и ServerName хоста брокера
+func dial(cfg *tls.Config, addr string) error {
+	cfg = cfg.Clone()
+	cfg.ServerName = "localhost"
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", addr, cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// В TLS 1.3 сервер проверяет клиентский сертификат уже после рукопожатия клиента
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	if string(buf) != "ok" {
+		return errors.New("unexpected reply " + string(buf))
+	}
+
+	return nil
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := newTestCA(t, dir, "kafka-ca")
+	serverCert, serverKey := ca.issue(t, dir, "broker", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "order-service", x509.ExtKeyUsageClientAuth)
+	addr := startBroker(t, ca, serverCert, serverKey)
+
+	unknown := newTestCA(t, dir, "unknown-ca")
+	strangerCert, strangerKey := unknown.issue(t, dir, "stranger", x509.ExtKeyUsageClientAuth)
+
+	tests := []struct {
+		name    string
+		cfg     config.KafkaTLS
+		wantErr string
+	}{
+		{
+			name: "trusted CA with client certificate",
+			cfg:  config.KafkaTLS{Enabled: true, CAFile: ca.file, CertFile: clientCert, KeyFile: clientKey},
+		},
+		{
+			name:    "unknown CA",
+			cfg:     config.KafkaTLS{Enabled: true, CAFile: unknown.file, CertFile: clientCert, KeyFile: clientKey},
+			wantErr: "certificate signed by unknown authority",
+		},
+		{
+			name:    "no client certificate",
+			cfg:     config.KafkaTLS{Enabled: true, CAFile: ca.file},
+			wantErr: "certificate required",
+		},
+		{
+			// Брокер перечисляет допустимые CA, поэтому чужой сертификат клиент не отправляет
+			name:    "client certificate from unknown CA",
+			cfg:     config.KafkaTLS{Enabled: true, CAFile: ca.file, CertFile: strangerCert, KeyFile: strangerKey},
+			wantErr: "certificate required",
+		},
+		{
+			name: "insecure skip verify",
+			cfg:  config.KafkaTLS{Enabled: true, InsecureSkipVerify: true, CertFile: clientCert, KeyFile: clientKey},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := TLSConfig(tt.cfg)
+			if err != nil {
+				t.Fatalf("TLSConfig: %v", err)
+			}
+
+			err = dial(tlsConfig, addr)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("handshake failed: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("handshake succeeded, want %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("handshake error %q, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "kafka-ca")
+	clientCert, clientKey := ca.issue(t, dir, "order-service", x509.ExtKeyUsageClientAuth)
+
+	notPEM := filepath.Join(dir, "not-pem.txt")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.KafkaTLS
+		wantErr string
+	}{
+		{"missing CA file", config.KafkaTLS{Enabled: true, CAFile: filepath.Join(dir, "missing.pem")}, "failed to read kafka CA file"},
+		{"CA file without certificates", config.KafkaTLS{Enabled: true, CAFile: notPEM}, "no certificates found"},
+		{"cert without key", config.KafkaTLS{Enabled: true, CertFile: clientCert}, "requires both cert and key"},
+		{"key without cert", config.KafkaTLS{Enabled: true, KeyFile: clientKey}, "requires both cert and key"},
+		{"mismatched key", config.KafkaTLS{Enabled: true, CertFile: clientCert, KeyFile: notPEM}, "failed to load kafka client certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := TLSConfig(tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("TLSConfig error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		tlsConfig, err := TLSConfig(config.KafkaTLS{CAFile: filepath.Join(dir, "missing.pem")})
+		if err != nil || tlsConfig != nil {
+			t.Fatalf("TLSConfig = %v, %v, want nil, nil", tlsConfig, err)
+		}
+	})
+}
+
+func TestTLSConfigLoadsClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "kafka-ca")
+	clientCert, clientKey := ca.issue(t, dir, "order-service", x509.ExtKeyUsageClientAuth)
+
+	tlsConfig, err := TLSConfig(config.KafkaTLS{Enabled: true, CAFile: ca.file, CertFile: clientCert, KeyFile: clientKey})
+	if err != nil {
+		t.Fatalf("TLSConfig: %v", err)
+	}
+
+	if len(tlsConfig.Certificates) != 1 {
+		t.Fatalf("client certificates = %d, want 1", len(tlsConfig.Certificates))
+	}
+	leaf, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leaf.Subject.CommonName != "order-service" {
+		t.Errorf("client certificate CN = %q, want order-service", leaf.Subject.CommonName)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("MinVersion = %x, want TLS 1.2", tlsConfig.MinVersion)
+	}
+}
@@ -0,0 +1,22 @@
+package audit
+
+import "context"
+
+// Info описывает происхождение записи: откуда пришли данные и в рамках какого trace
+type Info struct {
+	TraceID      string
+	SourceSystem string
+}
+
+type ctxKey struct{}
+
+// WithInfo кладет аудит-информацию в контекст для хранилища
+func WithInfo(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, ctxKey{}, info)
+}
+
+// FromContext возвращает аудит-информацию из контекста, если она есть
+func FromContext(ctx context.Context) Info {
+	info, _ := ctx.Value(ctxKey{}).(Info)
+	return info
+}
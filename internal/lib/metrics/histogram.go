@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets покрывают задержки от миллисекунды до минуты
+var DefaultBuckets = []time.Duration{
+	time.Millisecond, 2 * time.Millisecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second,
+	10 * time.Second, 30 * time.Second, time.Minute,
+}
+
+// Histogram считает распределение длительностей по фиксированным корзинам.
+// Публикуется через expvar и отдается на /debug/vars
+type Histogram struct {
+	mu      sync.Mutex
+	bounds  []time.Duration
+	buckets []uint64
+	count   uint64
+	sum     time.Duration
+	max     time.Duration
+}
+
+// NewHistogram создает гистограмму и публикует ее в expvar под именем name
+func NewHistogram(name string, bounds []time.Duration) *Histogram {
+	h := &Histogram{
+		bounds:  bounds,
+		buckets: make([]uint64, len(bounds)+1),
+	}
+	expvar.Publish(name, h)
+
+	return h
+}
+
+// Observe добавляет одно наблюдение
+func (h *Histogram) Observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i := 0
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+	h.buckets[i]++
+	h.count++
+	h.sum += d
+	h.max = max(h.max, d)
+}
+
+// Quantile оценивает квантиль q по верхней границе корзины
+func (h *Histogram) Quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.quantile(q)
+}
+
+func (h *Histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	var seen uint64
+	for i, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			if i < len(h.bounds) {
+				return min(h.bounds[i], h.max)
+			}
+			return h.max
+		}
+	}
+
+	return h.max
+}
+
+// String реализует expvar.Var
+func (h *Histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := make(map[string]uint64, len(h.buckets))
+	for i, n := range h.buckets {
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = h.bounds[i].String()
+		}
+		buckets[le] = n
+	}
+
+	var mean time.Duration
+	if h.count > 0 {
+		mean = h.sum / time.Duration(h.count)
+	}
+
+	b, _ := json.Marshal(map[string]any{
+		"count":   h.count,
+		"mean":    mean.String(),
+		"max":     h.max.String(),
+		"p50":     h.quantile(0.50).String(),
+		"p95":     h.quantile(0.95).String(),
+		"p99":     h.quantile(0.99).String(),
+		"buckets": buckets,
+	})
+
+	return string(b)
+}
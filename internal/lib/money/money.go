@@ -0,0 +1,294 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// scaleDigits задает число знаков после запятой в Amount. Четырех знаков хватает
+// для любой валюты ISO 4217, поэтому сумму можно разобрать, еще не зная валюты
+const scaleDigits = 4
+
+// scale является числом долей единицы валюты в Amount
+const scale = 10000
+
+var (
+	ErrPrecision = errors.New("amount is finer than the currency minor unit")
+	ErrSyntax    = errors.New("invalid amount")
+	ErrRange     = errors.New("amount is out of range")
+)
+
+// Amount является денежной суммой с фиксированной точностью в десятитысячных долях единицы
+// валюты. В JSON и CSV сумма пишется в единицах валюты: 1817 или 18.17, так что целые суммы
+// прежних сообщений читаются без изменений. Валюта хранится рядом, например в Payment.Currency
+type Amount int64
+
+// Major возвращает сумму из целого числа единиц валюты. ErrRange означает,
+// что сумма не помещается в Amount
+func Major(units int64) (Amount, error) {
+	v, ok := mul(units, scale)
+	if !ok {
+		return 0, fmt.Errorf("%w: %d units", ErrRange, units)
+	}
+
+	return Amount(v), nil
+}
+
+// FromMinor возвращает сумму из минорных единиц валюты c, например копеек.
+// ErrRange означает, что сумма не помещается в Amount
+func FromMinor(minor int64, c Currency) (Amount, error) {
+	v, ok := mul(minor, c.factor())
+	if !ok {
+		return 0, fmt.Errorf("%w: %d minor units of %s", ErrRange, minor, c.Code)
+	}
+
+	return Amount(v), nil
+}
+
+// Minor возвращает сумму в минорных единицах валюты c. ErrPrecision означает,
+// что у суммы больше знаков после запятой, чем допускает валюта
+func (a Amount) Minor(c Currency) (int64, error) {
+	if int64(a)%c.factor() != 0 {
+		return 0, fmt.Errorf("%w: %s has more than %d decimal places", ErrPrecision, a, c.Exponent)
+	}
+
+	return int64(a) / c.factor(), nil
+}
+
+// MinorUnits переводит суммы в минорные единицы валюты c, см. Amount.Minor
+func MinorUnits(c Currency, amounts ...Amount) ([]int64, error) {
+	minor := make([]int64, len(amounts))
+	for i, a := range amounts {
+		var err error
+		if minor[i], err = a.Minor(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return minor, nil
+}
+
+// FromMinorUnits записывает в dst суммы из минорных единиц валюты c, см. FromMinor
+func FromMinorUnits(c Currency, minor []int64, dst ...*Amount) error {
+	for i, v := range minor {
+		a, err := FromMinor(v, c)
+		if err != nil {
+			return err
+		}
+		*dst[i] = a
+	}
+
+	return nil
+}
+
+// Whole возвращает сумму в целых единицах валюты, false означает наличие дробной части
+func (a Amount) Whole() (int64, bool) {
+	return int64(a) / scale, int64(a)%scale == 0
+}
+
+// Round округляет сумму до минорной единицы валюты c, половина округляется от нуля
+func (a Amount) Round(c Currency) Amount {
+	return Amount(divRound(int64(a), c.factor()) * c.factor())
+}
+
+// Mul умножает сумму на количество, ErrRange означает переполнение
+func (a Amount) Mul(n int64) (Amount, error) {
+	v, ok := mul(int64(a), n)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s * %d", ErrRange, a, n)
+	}
+
+	return Amount(v), nil
+}
+
+// mul умножает с проверкой переполнения int64
+func mul(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	// MinInt64 / -1 в Go снова дает MinInt64, поэтому этот случай проверяется отдельно
+	v := a * b
+	if v/b != a || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// Discount возвращает сумму за вычетом скидки percent процентов от 0 до 100, округленную
+// до минорной единицы валюты c. Целые сотни долей умножаются отдельно от остатка,
+// чтобы произведение не переполняло int64
+func (a Amount) Discount(percent int, c Currency) Amount {
+	keep := int64(100 - percent)
+	q, r := int64(a)/100, int64(a)%100
+
+	return Amount(q*keep + divRound(r*keep, 100)).Round(c)
+}
+
+// Sum складывает суммы, ErrRange означает переполнение
+func Sum(amounts ...Amount) (Amount, error) {
+	var total int64
+	for _, a := range amounts {
+		v, ok := add(total, int64(a))
+		if !ok {
+			return 0, fmt.Errorf("%w: %s + %s", ErrRange, Amount(total), a)
+		}
+		total = v
+	}
+
+	return Amount(total), nil
+}
+
+// Sub вычитает b из суммы, ErrRange означает переполнение
+func (a Amount) Sub(b Amount) (Amount, error) {
+	v, ok := add(int64(a), -int64(b))
+	if !ok || b == math.MinInt64 {
+		return 0, fmt.Errorf("%w: %s - %s", ErrRange, a, b)
+	}
+
+	return Amount(v), nil
+}
+
+// add складывает с проверкой переполнения int64
+func add(a, b int64) (int64, bool) {
+	v := a + b
+	if (b > 0 && v < a) || (b < 0 && v > a) {
+		return 0, false
+	}
+
+	return v, true
+}
+
+// divRound делит с округлением половины от нуля
+func divRound(a, b int64) int64 {
+	q, r := a/b, a%b
+	if 2*abs(r) >= b {
+		if a < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+
+	return q
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
+
+// String пишет сумму в единицах валюты без лишних нулей: 1817, 18.17, -0.5
+func (a Amount) String() string {
+	v := int64(a)
+	sign := ""
+	if v < 0 {
+		sign = "-"
+	}
+
+	whole, frac := abs(v/scale), abs(v%scale)
+	if frac == 0 {
+		return sign + strconv.FormatInt(whole, 10)
+	}
+
+	digits := strings.TrimRight(fmt.Sprintf("%0*d", scaleDigits, frac), "0")
+
+	return sign + strconv.FormatInt(whole, 10) + "." + digits
+}
+
+// Format пишет сумму с числом знаков минорной единицы валюты c: 18.10 RUB, 500 JPY
+func (a Amount) Format(c Currency) string {
+	s := a.Round(c).String()
+	if c.Exponent > 0 {
+		whole, frac, _ := strings.Cut(s, ".")
+		s = whole + "." + frac + strings.Repeat("0", c.Exponent-len(frac))
+	}
+
+	return s + " " + c.Code
+}
+
+// Parse разбирает сумму в единицах валюты. Допускаются знак, дробная часть
+// до четырех знаков и экспонента JSON чисел, если результат точно представим
+func Parse(s string) (Amount, error) {
+	mantissa, exp := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q", ErrSyntax, s)
+		}
+		mantissa, exp = s[:i], e
+	}
+
+	neg := strings.HasPrefix(mantissa, "-")
+	mantissa = strings.TrimPrefix(mantissa, "-")
+
+	whole, frac, _ := strings.Cut(mantissa, ".")
+	if whole == "" || !digitsOnly(whole) || !digitsOnly(frac) {
+		return 0, fmt.Errorf("%w: %q", ErrSyntax, s)
+	}
+
+	// Значение равно whole+frac, умноженному на 10^shift десятитысячных
+	digits := strings.TrimLeft(whole+frac, "0")
+	if digits == "" {
+		return 0, nil
+	}
+	shift := exp - len(frac) + scaleDigits
+	switch {
+	case shift < 0:
+		cut := max(len(digits)+shift, 0)
+		if strings.Trim(digits[cut:], "0") != "" {
+			return 0, fmt.Errorf("%w: %q has more than %d decimal places", ErrPrecision, s, scaleDigits)
+		}
+		digits = digits[:cut]
+	case len(digits)+shift > 19:
+		return 0, fmt.Errorf("%w: %q", ErrRange, s)
+	default:
+		digits += strings.Repeat("0", shift)
+	}
+
+	v, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrRange, s)
+	}
+	if neg {
+		v = -v
+	}
+
+	return Amount(v), nil
+}
+
+func digitsOnly(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MarshalJSON пишет сумму JSON числом в единицах валюты
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON принимает JSON число в единицах валюты
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	v, err := Parse(string(data))
+	if err != nil {
+		return err
+	}
+	*a = v
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestOverflow(t *testing.T) {
+	jpy, _ := LookupCurrency("JPY")
+	rub, _ := LookupCurrency("RUB")
+
+	tests := []struct {
+		name    string
+		fn      func() (Amount, error)
+		want    Amount
+		wantErr bool
+	}{
+		{"major", func() (Amount, error) { return Major(1817) }, 18170000, false},
+		{"major max", func() (Amount, error) { return Major(math.MaxInt64 / scale) }, math.MaxInt64 / scale * scale, false},
+		{"major overflow", func() (Amount, error) { return Major(math.MaxInt64/scale + 1) }, 0, true},
+		{"major negative overflow", func() (Amount, error) { return Major(math.MinInt64 / 2) }, 0, true},
+		{"minor", func() (Amount, error) { return FromMinor(181750, rub) }, 18175000, false},
+		{"minor overflow", func() (Amount, error) { return FromMinor(math.MaxInt64/100+1, rub) }, 0, true},
+		{"minor without subunit overflow", func() (Amount, error) { return FromMinor(math.MaxInt64/scale+1, jpy) }, 0, true},
+		{"mul", func() (Amount, error) { return Amount(4530000).Mul(3) }, 13590000, false},
+		{"mul overflow", func() (Amount, error) { return Amount(math.MaxInt64 / 2).Mul(3) }, 0, true},
+		{"mul min by -1", func() (Amount, error) { return Amount(math.MinInt64).Mul(-1) }, 0, true},
+		{"mul -1 by min", func() (Amount, error) { return Amount(-1).Mul(math.MinInt64) }, 0, true},
+		{"sum", func() (Amount, error) { return Sum(3170000, 15000000, 0) }, 18170000, false},
+		{"sum overflow", func() (Amount, error) { return Sum(math.MaxInt64/2, math.MaxInt64/2, 2) }, 0, true},
+		{"sum negative overflow", func() (Amount, error) { return Sum(math.MinInt64, -1) }, 0, true},
+		{"sub", func() (Amount, error) { return Amount(18170000).Sub(15000000) }, 3170000, false},
+		{"sub overflow", func() (Amount, error) { return Amount(math.MinInt64).Sub(1) }, 0, true},
+		{"sub min", func() (Amount, error) { return Amount(0).Sub(math.MinInt64) }, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.fn()
+			if tt.wantErr {
+				if !errors.Is(err, ErrRange) {
+					t.Fatalf("got %s, %v, want ErrRange", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("got %s, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscount(t *testing.T) {
+	rub, _ := LookupCurrency("RUB")
+
+	tests := []struct {
+		amount  Amount
+		percent int
+		want    Amount
+	}{
+		{4530000, 30, 3171000},
+		{-4530000, 30, -3171000},
+		{50, 50, 0},
+		{math.MaxInt64 / scale * scale, 0, math.MaxInt64 / scale * scale},
+		{math.MaxInt64 / scale * scale, 50, 4611686018427385000},
+	}
+
+	for _, tt := range tests {
+		if got := tt.amount.Discount(tt.percent, rub); got != tt.want {
+			t.Errorf("%s.Discount(%d) = %s, want %s", tt.amount, tt.percent, got, tt.want)
+		}
+	}
+}
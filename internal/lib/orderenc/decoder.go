@@ -0,0 +1,92 @@
+package orderenc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Decoder потоково читает заказы из JSON массива или NDJSON, не буферизуя весь вход.
+// Формат определяется по первому значащему символу
+type Decoder struct {
+	br      *bufio.Reader
+	dec     *json.Decoder
+	inArray bool
+	started bool
+	done    bool
+}
+
+// NewDecoder создает потоковый декодер
+func NewDecoder(r io.Reader) *Decoder {
+	br := bufio.NewReader(r)
+	return &Decoder{br: br, dec: json.NewDecoder(br)}
+}
+
+// Next возвращает сырой JSON следующего заказа или io.EOF, когда вход закончился.
+// Синтаксическая ошибка делает дальнейшее чтение невозможным
+func (d *Decoder) Next() (json.RawMessage, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+
+	if !d.started {
+		d.started = true
+		if err := d.detectArray(); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.inArray && !d.dec.More() {
+		d.done = true
+		if _, err := d.dec.Token(); err != nil {
+			return nil, fmt.Errorf("failed to read end of array: %w", err)
+		}
+		if _, err := d.dec.Token(); !errors.Is(err, io.EOF) {
+			return nil, errors.New("unexpected data after array")
+		}
+		return nil, io.EOF
+	}
+
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err != nil {
+		if errors.Is(err, io.EOF) && !d.inArray {
+			d.done = true
+			return nil, io.EOF
+		}
+		d.done = true
+		return nil, fmt.Errorf("failed to decode order: %w", err)
+	}
+
+	return raw, nil
+}
+
+// InputOffset возвращает число прочитанных байт, удобно для отчетов об ошибках
+func (d *Decoder) InputOffset() int64 {
+	return d.dec.InputOffset()
+}
+
+func (d *Decoder) detectArray() error {
+	for {
+		b, err := d.br.Peek(1)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = d.br.ReadByte()
+			continue
+		case '[':
+			d.inArray = true
+			_, err := d.dec.Token()
+			return err
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package orderenc
+
+import (
+	"L0/internal/models"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+
+	ContentTypeJSON   = "application/json"
+	ContentTypeNDJSON = "application/x-ndjson"
+	ContentTypeCSV    = "text/csv"
+)
+
+// Writer потоково пишет заказы в одном из форматов. Close дописывает хвост формата
+// и сбрасывает буфер, но не закрывает нижележащий io.Writer
+type Writer interface {
+	Write(order models.Order) error
+	Flush() error
+	Close() error
+}
+
+type options struct {
+	skipCSVHeader bool
+}
+
+type Option func(*options)
+
+// SkipCSVHeader отключает заголовок CSV, нужно при дописывании в существующий файл
+func SkipCSVHeader() Option {
+	return func(o *options) {
+		o.skipCSVHeader = true
+	}
+}
+
+// NewWriter создает Writer для формата json, ndjson или csv
+func NewWriter(format string, w io.Writer, opts ...Option) (Writer, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	switch format {
+	case FormatJSON:
+		return newJSONArrayWriter(w), nil
+	case FormatNDJSON:
+		return newNDJSONWriter(w), nil
+	case FormatCSV:
+		cw := newCSVWriter(w)
+		cw.wroteHeader = o.skipCSVHeader
+		return cw, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// ContentType возвращает MIME тип формата
+func ContentType(format string) string {
+	switch format {
+	case FormatNDJSON:
+		return ContentTypeNDJSON
+	case FormatCSV:
+		return ContentTypeCSV + "; charset=utf-8"
+	default:
+		return ContentTypeJSON
+	}
+}
+
+type ndjsonWriter struct {
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buf := bufio.NewWriter(w)
+	return &ndjsonWriter{buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (w *ndjsonWriter) Write(order models.Order) error {
+	return w.enc.Encode(order)
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.buf.Flush()
+}
+
+type jsonArrayWriter struct {
+	buf   *bufio.Writer
+	count int
+}
+
+func newJSONArrayWriter(w io.Writer) *jsonArrayWriter {
+	return &jsonArrayWriter{buf: bufio.NewWriter(w)}
+}
+
+func (w *jsonArrayWriter) Write(order models.Order) error {
+	b, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	sep := byte(',')
+	if w.count == 0 {
+		sep = '['
+	}
+	w.count++
+
+	if err := w.buf.WriteByte(sep); err != nil {
+		return err
+	}
+	_, err = w.buf.Write(b)
+	return err
+}
+
+func (w *jsonArrayWriter) Flush() error {
+	return w.buf.Flush()
+}
+
+func (w *jsonArrayWriter) Close() error {
+	if w.count == 0 {
+		if err := w.buf.WriteByte('['); err != nil {
+			return err
+		}
+	}
+	if _, err := w.buf.WriteString("]\n"); err != nil {
+		return err
+	}
+
+	return w.buf.Flush()
+}
+
+// CSVHeader содержит колонки плоского CSV представления: заказ, доставка, оплата и товар
+var CSVHeader = []string{
+	"order_uid", "track_number", "entry", "locale", "internal_signature", "customer_id",
+	"delivery_service", "shardkey", "sm_id", "date_created", "oof_shard",
+	"delivery_name", "delivery_phone", "delivery_zip", "delivery_city",
+	"delivery_address", "delivery_region", "delivery_email",
+	"payment_transaction", "payment_request_id", "payment_currency", "payment_provider",
+	"payment_amount", "payment_dt", "payment_bank", "payment_delivery_cost",
+	"payment_goods_total", "payment_custom_fee",
+	"item_chrt_id", "item_track_number", "item_price", "item_rid", "item_name",
+	"item_sale", "item_size", "item_total_price", "item_nm_id", "item_brand", "item_status",
+}
+
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+// Write пишет по строке на каждый товар. Заказ без товаров дает одну строку с пустыми колонками товара
+func (w *csvWriter) Write(order models.Order) error {
+	if !w.wroteHeader {
+		if err := w.w.Write(CSVHeader); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+
+	base := orderColumns(order)
+
+	if len(order.Items) == 0 {
+		return w.w.Write(append(base, make([]string, 11)...))
+	}
+
+	for _, item := range order.Items {
+		if err := w.w.Write(append(base[:len(base):len(base)], itemColumns(item)...)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *csvWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvWriter) Close() error {
+	if !w.wroteHeader {
+		if err := w.w.Write(CSVHeader); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+
+	return w.Flush()
+}
+
+func orderColumns(o models.Order) []string {
+	return []string{
+		o.OrderUID, o.TrackNumber, o.Entry, o.Locale, o.InternalSignature, o.CustomerID,
+		o.DeliveryService, o.Shardkey, strconv.Itoa(o.SmID), o.DateCreated.Format(time.RFC3339Nano), o.OofShard,
+		o.Delivery.Name, o.Delivery.Phone, o.Delivery.Zip, o.Delivery.City,
+		o.Delivery.Address, o.Delivery.Region, o.Delivery.Email,
+		o.Payment.Transaction, o.Payment.RequestID, o.Payment.Currency, o.Payment.Provider,
+		o.Payment.Amount.String(), strconv.FormatInt(o.Payment.PaymentDT, 10), o.Payment.Bank,
+		o.Payment.DeliveryCost.String(), o.Payment.GoodsTotal.String(), o.Payment.CustomFee.String(),
+	}
+}
+
+func itemColumns(i models.Item) []string {
+	return []string{
+		strconv.FormatInt(i.ChrtID, 10), i.TrackNumber, i.Price.String(), i.RID, i.Name,
+		strconv.Itoa(i.Sale), i.Size, i.TotalPrice.String(), strconv.FormatInt(i.NmID, 10),
+		i.Brand, strconv.Itoa(i.Status),
+	}
+}
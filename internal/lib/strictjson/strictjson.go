@@ -0,0 +1,229 @@
+package strictjson
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Режимы разбора JSON
+const (
+	// ModeStrict отклоняет неизвестные поля и данные после JSON значения
+	ModeStrict = "strict"
+	// ModeLenient молча игнорирует неизвестные поля, как encoding/json
+	ModeLenient = "lenient"
+	// ModeLogged принимает документ, но возвращает найденные нарушения для логирования
+	ModeLogged = "logged"
+)
+
+// Error перечисляет нарушения в документе с JSON путями до них
+type Error struct {
+	Problems []string
+}
+
+func (e *Error) Error() string {
+	return "invalid json: " + strings.Join(e.Problems, "; ")
+}
+
+// Unmarshal разбирает data в v в указанном режиме. В режиме logged документ принимается,
+// а нарушения возвращаются вызывающему. Ошибки типов всегда отклоняются с путем до поля
+func Unmarshal(data []byte, v any, mode string) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(v); err != nil {
+		return nil, describe(err)
+	}
+
+	if mode != ModeStrict && mode != ModeLogged {
+		return nil, nil
+	}
+
+	end := dec.InputOffset()
+
+	var problems []string
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		problems = append(problems, "unexpected data after top-level value")
+	}
+
+	var doc any
+	if err := json.Unmarshal(data[:end], &doc); err == nil {
+		problems = append(problems, unknownFields(doc, reflect.TypeOf(v), "")...)
+	}
+
+	if len(problems) > 0 && mode == ModeStrict {
+		return nil, &Error{Problems: problems}
+	}
+
+	return problems, nil
+}
+
+// describe переводит ошибки encoding/json в Error с путем до поля
+func describe(err error) error {
+	var (
+		typeErr   *json.UnmarshalTypeError
+		syntaxErr *json.SyntaxError
+	)
+	switch {
+	case errors.As(err, &typeErr):
+		path := indexPath(typeErr.Field)
+		if path == "" {
+			path = "$"
+		}
+		return &Error{Problems: []string{fmt.Sprintf("%s: cannot use %s as %s", path, typeErr.Value, typeErr.Type)}}
+	case errors.As(err, &syntaxErr):
+		return &Error{Problems: []string{fmt.Sprintf("syntax error at offset %d: %v", syntaxErr.Offset, err)}}
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return &Error{Problems: []string{"unexpected end of JSON input"}}
+	}
+
+	return err
+}
+
+// indexPath приводит путь encoding/json вида items.0.price к виду items[0].price,
+// которым unknownFields сообщает о неизвестных полях
+func indexPath(field string) string {
+	if field == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	for i, part := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(part); err == nil && i > 0 {
+			b.WriteString("[" + part + "]")
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(part)
+	}
+
+	return b.String()
+}
+
+var (
+	jsonUnmarshaler = reflect.TypeFor[json.Unmarshaler]()
+	textUnmarshaler = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// unknownFields сравнивает разобранный документ с json тегами типа t и возвращает
+// пути ключей, которые encoding/json проигнорировал бы
+func unknownFields(doc any, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshaler) || reflect.PointerTo(t).Implements(textUnmarshaler) {
+		return nil
+	}
+
+	var problems []string
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil
+		}
+		fields := structFields(t)
+		for _, key := range sortedKeys(obj) {
+			field, ok := lookup(fields, key)
+			if !ok {
+				problems = append(problems, "unknown field "+join(path, key))
+				continue
+			}
+			problems = append(problems, unknownFields(obj[key], field, join(path, key))...)
+		}
+	case reflect.Map:
+		obj, ok := doc.(map[string]any)
+		if !ok {
+			return nil
+		}
+		for _, key := range sortedKeys(obj) {
+			problems = append(problems, unknownFields(obj[key], t.Elem(), join(path, key))...)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := doc.([]any)
+		if !ok {
+			return nil
+		}
+		for i, el := range arr {
+			problems = append(problems, unknownFields(el, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+
+	return problems
+}
+
+// structFields собирает имена полей так же, как encoding/json, включая встроенные структуры
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range structFields(ft) {
+					if _, ok := fields[k]; !ok {
+						fields[k] = v
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+
+	return fields
+}
+
+// lookup ищет поле сначала точно, затем без учета регистра, как encoding/json
+func lookup(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return t, true
+		}
+	}
+
+	return nil, false
+}
+
+func sortedKeys(obj map[string]any) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
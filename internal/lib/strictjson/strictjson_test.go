@@ -0,0 +1,159 @@
+package strictjson
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type item struct {
+	ChrtID int    `json:"chrt_id"`
+	Name   string `json:"name"`
+}
+
+type base struct {
+	ID string `json:"id"`
+}
+
+type doc struct {
+	base
+	Delivery struct {
+		City string `json:"city"`
+	} `json:"delivery"`
+	Items    []item          `json:"items"`
+	Meta     map[string]item `json:"meta"`
+	Created  time.Time       `json:"created"`
+	Internal string          `json:"-"`
+}
+
+func TestUnknownFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		problems []string
+	}{
+		{"known fields", `{"id": "1", "delivery": {"city": "Kazan"}, "items": [{"chrt_id": 1}]}`, nil},
+		{"case-insensitive match", `{"ID": "1", "Items": [{"Chrt_ID": 1}]}`, nil},
+		{"text unmarshaler is not inspected", `{"created": "2024-01-02T15:04:05Z"}`, nil},
+		{"top level", `{"id": "1", "note": "x"}`, []string{"unknown field note"}},
+		{"ignored by tag", `{"Internal": "x"}`, []string{"unknown field Internal"}},
+		{"nested struct", `{"delivery": {"city": "Kazan", "zip": "420000"}}`, []string{"unknown field delivery.zip"}},
+		{"slice element", `{"items": [{"chrt_id": 1}, {"chrtid": 2}]}`, []string{"unknown field items[1].chrtid"}},
+		{"map value", `{"meta": {"gift": {"name": "x", "wrap": true}}}`, []string{"unknown field meta.gift.wrap"}},
+		{
+			"sorted paths",
+			`{"z": 1, "items": [{"b": 1, "a": 2}]}`,
+			[]string{"unknown field items[0].a", "unknown field items[0].b", "unknown field z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v doc
+			problems, err := Unmarshal([]byte(tt.data), &v, ModeLogged)
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !slices.Equal(problems, tt.problems) {
+				t.Errorf("problems = %q, want %q", problems, tt.problems)
+			}
+		})
+	}
+}
+
+func TestIndexPath(t *testing.T) {
+	tests := map[string]string{
+		"":                "",
+		"id":              "id",
+		"items.0.chrt_id": "items[0].chrt_id",
+		"items.12":        "items[12]",
+		"a.1.b.2.c":       "a[1].b[2].c",
+	}
+
+	for field, want := range tests {
+		if got := indexPath(field); got != want {
+			t.Errorf("indexPath(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		mode     string
+		err      bool
+		problems []string
+	}{
+		{"strict unknown field", `{"items": [{"chrtid": 1}]}`, ModeStrict, true, []string{"unknown field items[0].chrtid"}},
+		{"lenient unknown field", `{"items": [{"chrtid": 1}]}`, ModeLenient, false, nil},
+		{"logged unknown field", `{"items": [{"chrtid": 1}]}`, ModeLogged, false, []string{"unknown field items[0].chrtid"}},
+		{"strict trailing data", `{"id": "1"} {"id": "2"}`, ModeStrict, true, []string{"unexpected data after top-level value"}},
+		{"lenient trailing data", `{"id": "1"} {"id": "2"}`, ModeLenient, false, nil},
+		{"logged trailing data", `{"id": "1"} garbage`, ModeLogged, false, []string{"unexpected data after top-level value"}},
+		{"trailing whitespace", "{\"id\": \"1\"}\n\t ", ModeStrict, false, nil},
+		{
+			"trailing data and unknown field",
+			`{"note": 1} []`, ModeStrict, true,
+			[]string{"unexpected data after top-level value", "unknown field note"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v doc
+			problems, err := Unmarshal([]byte(tt.data), &v, tt.mode)
+			if (err != nil) != tt.err {
+				t.Fatalf("Unmarshal() error = %v, want error %t", err, tt.err)
+			}
+			if err != nil {
+				var jsonErr *Error
+				if !errors.As(err, &jsonErr) {
+					t.Fatalf("error = %T, want *Error", err)
+				}
+				problems = jsonErr.Problems
+			}
+			if !slices.Equal(problems, tt.problems) {
+				t.Errorf("problems = %q, want %q", problems, tt.problems)
+			}
+			if v.ID != "1" && strings.Contains(tt.data, `"id": "1"`) {
+				t.Errorf("id = %q, want the first value decoded", v.ID)
+			}
+		})
+	}
+}
+
+// TestInvalid проверяет, что ошибки типов и синтаксиса отклоняются в любом режиме
+func TestInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		// Старые версии encoding/json не сообщают индекс элемента
+		{"type in slice", `{"items": [{"chrt_id": "1"}]}`, "chrt_id: cannot use string as int"},
+		{"type in nested struct", `{"delivery": {"city": 1}}`, "delivery.city: cannot use number as string"},
+		{"type at top level", `[]`, "$: cannot use array as strictjson.doc"},
+		{"syntax", `{"id": }`, "syntax error at offset"},
+		{"truncated", `{"id": "1"`, "unexpected end of JSON input"},
+		{"empty", ``, "unexpected end of JSON input"},
+	}
+
+	for _, mode := range []string{ModeStrict, ModeLenient, ModeLogged} {
+		for _, tt := range tests {
+			t.Run(mode+"/"+tt.name, func(t *testing.T) {
+				var v doc
+				_, err := Unmarshal([]byte(tt.data), &v, mode)
+				var jsonErr *Error
+				if !errors.As(err, &jsonErr) {
+					t.Fatalf("error = %v, want *Error", err)
+				}
+				if len(jsonErr.Problems) != 1 || !strings.Contains(jsonErr.Problems[0], tt.want) {
+					t.Errorf("problems = %q, want %q", jsonErr.Problems, tt.want)
+				}
+			})
+		}
+	}
+}
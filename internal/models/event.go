@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Статусы заказа. Статусы из order.status_changed приходят от внешних систем
+// и не ограничиваются этим списком
+const (
+	StatusCreated   = "created"
+	StatusPaid      = "paid"
+	StatusCancelled = "cancelled"
+)
+
+// OrderEvent является событием жизненного цикла уже сохраненного заказа
+type OrderEvent struct {
+	OrderUID   string
+	Type       string
+	Status     string
+	OccurredAt time.Time
+	// Payload хранит исходное тело события для истории заказа
+	Payload json.RawMessage
+}
+
+// Validate проверяет обязательные поля события
+func (e OrderEvent) Validate() error {
+	var reasons []string
+	if e.OrderUID == "" {
+		reasons = append(reasons, "order_uid is required")
+	}
+	if e.Status == "" {
+		reasons = append(reasons, "status is required")
+	}
+	if e.OccurredAt.IsZero() {
+		reasons = append(reasons, "event time is required")
+	}
+
+	if len(reasons) > 0 {
+		return &ValidationError{Reasons: reasons}
+	}
+
+	return nil
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"L0/internal/lib/money"
+	"fmt"
+	"time"
+)
 
 // Order является моделью данных
 type Order struct {
@@ -18,6 +22,26 @@ type Order struct {
 	SmID              int       `json:"sm_id"`
 	DateCreated       time.Time `json:"date_created"`
 	OofShard          string    `json:"oof_shard"`
+	Status            string    `json:"status,omitempty"`
+	// Warnings заполняется сервисом при приеме, присланные клиентом значения заменяются
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+// Normalize приводит заказ к виду, в котором его возвращает БД: date_created в UTC
+// с точностью PostgreSQL до микросекунд и пустой, а не nil, список товаров. Заказ из кэша
+// и тот же заказ из БД должны давать одинаковый JSON, иначе меняется ETag
+func (o *Order) Normalize() {
+	o.DateCreated = o.DateCreated.UTC().Round(time.Microsecond)
+	if o.Items == nil {
+		o.Items = []Item{}
+	}
+}
+
+// Warning описывает найденное в заказе несоответствие, которое не мешает его принять
+type Warning struct {
+	Rule    string `json:"rule"`
+	Path    string `json:"path"`
+	Message string `json:"message"`
 }
 
 type Delivery struct {
@@ -30,29 +54,55 @@ type Delivery struct {
 	Email   string `json:"email"`
 }
 
+// Payment хранит суммы в валюте Currency, код ISO 4217
 type Payment struct {
-	Transaction  string `json:"transaction"`
-	RequestID    string `json:"request_id"`
-	Currency     string `json:"currency"`
-	Provider     string `json:"provider"`
-	Amount       int    `json:"amount"`
-	PaymentDT    int64  `json:"payment_dt"`
-	Bank         string `json:"bank"`
-	DeliveryCost int    `json:"delivery_cost"`
-	GoodsTotal   int    `json:"goods_total"`
-	CustomFee    int    `json:"custom_fee"`
+	Transaction  string       `json:"transaction"`
+	RequestID    string       `json:"request_id"`
+	Currency     string       `json:"currency"`
+	Provider     string       `json:"provider"`
+	Amount       money.Amount `json:"amount"`
+	PaymentDT    int64        `json:"payment_dt"`
+	Bank         string       `json:"bank"`
+	DeliveryCost money.Amount `json:"delivery_cost"`
+	GoodsTotal   money.Amount `json:"goods_total"`
+	CustomFee    money.Amount `json:"custom_fee"`
 }
 
+// Item хранит цены в валюте оплаты заказа
 type Item struct {
-	ChrtID      int64  `json:"chrt_id"`
-	TrackNumber string `json:"track_number"`
-	Price       int    `json:"price"`
-	RID         string `json:"rid"`
-	Name        string `json:"name"`
-	Sale        int    `json:"sale"`
-	Size        string `json:"size"`
-	TotalPrice  int    `json:"total_price"`
-	NmID        int64  `json:"nm_id"`
-	Brand       string `json:"brand"`
-	Status      int    `json:"status"`
+	ChrtID      int64        `json:"chrt_id"`
+	TrackNumber string       `json:"track_number"`
+	Price       money.Amount `json:"price"`
+	RID         string       `json:"rid"`
+	Name        string       `json:"name"`
+	Sale        int          `json:"sale"`
+	Size        string       `json:"size"`
+	TotalPrice  money.Amount `json:"total_price"`
+	NmID        int64        `json:"nm_id"`
+	Brand       string       `json:"brand"`
+	Status      int          `json:"status"`
+}
+
+// AmountField указывает на денежное поле заказа вместе с JSON путем до него
+type AmountField struct {
+	Path   string
+	Amount *money.Amount
+}
+
+// AmountFields возвращает все денежные поля заказа. Все они в валюте Payment.Currency
+func (o *Order) AmountFields() []AmountField {
+	fields := []AmountField{
+		{"payment.amount", &o.Payment.Amount},
+		{"payment.delivery_cost", &o.Payment.DeliveryCost},
+		{"payment.goods_total", &o.Payment.GoodsTotal},
+		{"payment.custom_fee", &o.Payment.CustomFee},
+	}
+	for i := range o.Items {
+		fields = append(fields,
+			AmountField{fmt.Sprintf("items[%d].price", i), &o.Items[i].Price},
+			AmountField{fmt.Sprintf("items[%d].total_price", i), &o.Items[i].TotalPrice},
+		)
+	}
+
+	return fields
 }
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Статусы сообщения в карантине
+const (
+	QuarantineStatusQuarantined = "quarantined"
+	QuarantineStatusResubmitted = "resubmitted"
+)
+
+// QuarantinedMessage является сообщением Kafka, которое консюмер не смог обработать.
+// Сообщение хранится как есть, вместе с метаданными для повторной отправки
+type QuarantinedMessage struct {
+	ID            int64             `json:"id"`
+	Topic         string            `json:"topic"`
+	Partition     int               `json:"partition"`
+	Offset        int64             `json:"offset"`
+	Key           string            `json:"key,omitempty"`
+	Headers       map[string]string `json:"headers"`
+	EventType     string            `json:"event_type"`
+	ContentType   string            `json:"content_type"`
+	SchemaVersion string            `json:"schema_version"`
+	Payload       []byte            `json:"-"`
+	ErrorClass    string            `json:"error_class"`
+	ErrorMessage  string            `json:"error_message"`
+	SeenCount     int               `json:"seen_count"`
+	FirstSeenAt   time.Time         `json:"first_seen_at"`
+	LastSeenAt    time.Time         `json:"last_seen_at"`
+	EditedAt      *time.Time        `json:"edited_at,omitempty"`
+	ResubmittedAt *time.Time        `json:"resubmitted_at,omitempty"`
+	Status        string            `json:"status"`
+}
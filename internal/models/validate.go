@@ -0,0 +1,80 @@
+package models
+
+import (
+	"L0/internal/lib/money"
+	"fmt"
+	"strings"
+)
+
+// ValidationError содержит все найденные в заказе нарушения
+type ValidationError struct {
+	Reasons []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid order: " + strings.Join(e.Reasons, "; ")
+}
+
+// Validate проверяет обязательные поля, валюту и суммы заказа
+func (o Order) Validate() error {
+	var reasons []string
+	add := func(format string, args ...any) {
+		reasons = append(reasons, fmt.Sprintf(format, args...))
+	}
+
+	if o.OrderUID == "" {
+		add("order_uid is required")
+	}
+	if o.TrackNumber == "" {
+		add("track_number is required")
+	}
+	if o.CustomerID == "" {
+		add("customer_id is required")
+	}
+	if o.DateCreated.IsZero() {
+		add("date_created is required")
+	}
+
+	if o.Delivery.Name == "" {
+		add("delivery.name is required")
+	}
+	if o.Delivery.Email != "" && !strings.Contains(o.Delivery.Email, "@") {
+		add("delivery.email is malformed")
+	}
+
+	if o.Payment.Transaction == "" {
+		add("payment.transaction is required")
+	}
+	currency, err := money.LookupCurrency(o.Payment.Currency)
+	switch {
+	case o.Payment.Currency == "":
+		add("payment.currency is required")
+	case err != nil:
+		add("payment.currency must be an ISO 4217 code")
+	}
+	for _, f := range o.AmountFields() {
+		if *f.Amount < 0 {
+			add("%s must not be negative", f.Path)
+		}
+		if err == nil {
+			if _, err := f.Amount.Minor(currency); err != nil {
+				add("%s has more than %d decimal places for %s", f.Path, currency.Exponent, currency.Code)
+			}
+		}
+	}
+
+	for i, item := range o.Items {
+		if item.ChrtID == 0 {
+			add("items[%d].chrt_id is required", i)
+		}
+		if item.Sale < 0 || item.Sale > 100 {
+			add("items[%d].sale must be between 0 and 100", i)
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &ValidationError{Reasons: reasons}
+	}
+
+	return nil
+}
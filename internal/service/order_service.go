@@ -2,8 +2,10 @@ package service
 
 import (
 	"L0/internal/cache"
+	"L0/internal/consistency"
 	"L0/internal/models"
 	"L0/internal/storage/postgres"
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -12,17 +14,22 @@ import (
 type OrderService struct {
 	cache   *cache.OrderCache
 	storage postgres.OrderStorage
+	checker *consistency.Checker
 }
 
 var (
 	ErrOrderNotFound = errors.New("order not found")
+	ErrOrderExists   = errors.New("order already exists")
+	ErrEventExists   = errors.New("event already applied")
 )
 
-// New создает новый OrderService с предзагрузкой кэша
-func New(storage postgres.OrderStorage, cache *cache.OrderCache) *OrderService {
+// New создает новый OrderService с предзагрузкой кэша. checker может быть nil,
+// тогда денежная согласованность заказов не проверяется
+func New(storage postgres.OrderStorage, cache *cache.OrderCache, checker *consistency.Checker) *OrderService {
 	service := &OrderService{
 		cache:   cache,
 		storage: storage,
+		checker: checker,
 	}
 
 	// Предзагрузка кэша при старте
@@ -69,11 +76,62 @@ func (s *OrderService) GetOrder(orderUID string) (*models.Order, error) {
 	return order, nil
 }
 
-// SaveOrder сохраняет заказ
-func (s *OrderService) SaveOrder(order *models.Order) error {
-	if err := s.storage.SaveOrder(*order); err != nil {
+// SaveOrder валидирует и сохраняет заказ. Невалидный заказ возвращает *models.ValidationError.
+// Несогласованные суммы не мешают сохранению и попадают в order.Warnings. Заказ нормализуется
+// до сохранения, поэтому в кэше он такой же, каким его вернет БД
+func (s *OrderService) SaveOrder(ctx context.Context, order *models.Order) error {
+	if err := Prepare(order, s.checker); err != nil {
+		return err
+	}
+
+	if err := s.storage.SaveOrder(ctx, *order); err != nil {
+		if errors.Is(err, postgres.ErrOrderExists) {
+			return ErrOrderExists
+		}
 		return err
 	}
 	s.cache.Set(*order)
 	return nil
 }
+
+// Prepare готовит заказ к сохранению так же, как SaveOrder: нормализует, валидирует,
+// расставляет предупреждения и статус по умолчанию. Нужен тем, кто пишет в хранилище
+// пачками в обход сервиса, как импортер
+func Prepare(order *models.Order, checker *consistency.Checker) error {
+	order.Normalize()
+	if err := order.Validate(); err != nil {
+		return err
+	}
+	order.Warnings = checker.Check(*order)
+	if order.Status == "" {
+		order.Status = models.StatusCreated
+	}
+
+	return nil
+}
+
+// ApplyEvent применяет событие к сохраненному заказу и обновляет статус в кэше.
+// Событие для еще не сохраненного заказа возвращает ErrOrderNotFound
+func (s *OrderService) ApplyEvent(ctx context.Context, event models.OrderEvent) error {
+	if err := event.Validate(); err != nil {
+		return err
+	}
+
+	status, err := s.storage.ApplyEvent(ctx, event)
+	if err != nil {
+		switch {
+		case errors.Is(err, postgres.ErrOrderNotFound):
+			return ErrOrderNotFound
+		case errors.Is(err, postgres.ErrEventExists):
+			return ErrEventExists
+		}
+		return err
+	}
+
+	if order, exists := s.cache.Get(event.OrderUID); exists {
+		order.Status = status
+		s.cache.Set(order)
+	}
+
+	return nil
+}
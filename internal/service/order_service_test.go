@@ -0,0 +1,97 @@
+package service
+
+import (
+	"L0/internal/cache"
+	"L0/internal/http-server/conditional"
+	"L0/internal/lib/money"
+	"L0/internal/models"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// memStorage хранит заказы так же, как PostgreSQL: при чтении заказ нормализуется
+type memStorage struct {
+	orders map[string]models.Order
+}
+
+func (m *memStorage) SaveOrder(_ context.Context, order models.Order) error {
+	order.Items = append([]models.Item(nil), order.Items...)
+	m.orders[order.OrderUID] = order
+	return nil
+}
+
+func (m *memStorage) SaveOrders(ctx context.Context, orders []models.Order) []error {
+	errs := make([]error, len(orders))
+	for i, order := range orders {
+		errs[i] = m.SaveOrder(ctx, order)
+	}
+	return errs
+}
+
+func (m *memStorage) GetOrder(orderUID string) (*models.Order, error) {
+	order, ok := m.orders[orderUID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	order.DateCreated = order.DateCreated.In(time.FixedZone("session", 10*60*60))
+	order.Normalize()
+	return &order, nil
+}
+
+func (m *memStorage) GetAllOrders() ([]models.Order, error) {
+	return nil, nil
+}
+
+func (m *memStorage) ApplyEvent(context.Context, models.OrderEvent) (string, error) {
+	return "", nil
+}
+
+func TestSaveOrderCachesStoredForm(t *testing.T) {
+	storage := &memStorage{orders: map[string]models.Order{}}
+	orders := cache.New()
+	s := New(storage, orders, nil)
+
+	amount, err := money.FromMinor(150000, money.CurrencyOf("RUB"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := models.Order{
+		OrderUID:    "b563feb7b2b84b6test",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery:    models.Delivery{Name: "Test Testov", Phone: "+9720000000", Email: "test@gmail.com"},
+		Payment: models.Payment{
+			Transaction: "b563feb7b2b84b6test", Currency: "RUB", Provider: "wbpay",
+			Amount: amount, DeliveryCost: amount,
+		},
+		CustomerID:  "test",
+		DateCreated: time.Date(2021, 11, 26, 9, 22, 19, 123456789, time.FixedZone("MSK", 3*60*60)),
+	}
+	if err := s.SaveOrder(context.Background(), &order); err != nil {
+		t.Fatalf("SaveOrder: %v", err)
+	}
+
+	cached, ok := orders.Get(order.OrderUID)
+	if !ok {
+		t.Fatal("order is not cached")
+	}
+	stored, err := storage.GetOrder(order.OrderUID)
+	if err != nil {
+		t.Fatalf("GetOrder: %v", err)
+	}
+
+	if !reflect.DeepEqual(cached, *stored) {
+		t.Errorf("cached order differs from stored\ncached: %+v\nstored: %+v", cached, *stored)
+	}
+	if cached.Items == nil {
+		t.Error("cached items is nil, want empty slice")
+	}
+
+	cachedTag, _ := conditional.ETag(cached)
+	storedTag, _ := conditional.ETag(stored)
+	if cachedTag != storedTag {
+		t.Errorf("ETag from cache %s, from storage %s", cachedTag, storedTag)
+	}
+}
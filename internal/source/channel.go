@@ -0,0 +1,117 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+var ErrClosed = errors.New("source is closed")
+
+// Channel является источником в памяти для тестов и встраивания. Сообщения публикуются
+// через Publish, после Close и выдачи оставшихся Fetch возвращает io.EOF.
+// Nack возвращает сообщение в начало очереди
+type Channel struct {
+	msgs   chan Message
+	closed chan struct{}
+	once   sync.Once
+
+	mu        sync.Mutex
+	redeliver []Message
+	acked     []Message
+	nacked    []Message
+}
+
+// NewChannel создает источник с очередью на size сообщений
+func NewChannel(size int) *Channel {
+	return &Channel{
+		msgs:   make(chan Message, size),
+		closed: make(chan struct{}),
+	}
+}
+
+// Publish ставит сообщение в очередь, ожидая места в ней
+func (c *Channel) Publish(ctx context.Context, msg Message) error {
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+
+	select {
+	case c.msgs <- msg:
+		return nil
+	case <-c.closed:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Channel) Fetch(ctx context.Context) (Message, error) {
+	c.mu.Lock()
+	if len(c.redeliver) > 0 {
+		msg := c.redeliver[0]
+		c.redeliver = c.redeliver[1:]
+		c.mu.Unlock()
+		return msg, nil
+	}
+	c.mu.Unlock()
+
+	select {
+	case msg := <-c.msgs:
+		return msg, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	case <-c.closed:
+		// Сообщения, опубликованные до Close, выдаются до конца
+		select {
+		case msg := <-c.msgs:
+			return msg, nil
+		default:
+			return Message{}, io.EOF
+		}
+	}
+}
+
+func (c *Channel) Ack(_ context.Context, msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.acked = append(c.acked, msg)
+
+	return nil
+}
+
+func (c *Channel) Nack(_ context.Context, msg Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nacked = append(c.nacked, msg)
+	c.redeliver = append(c.redeliver, msg)
+
+	return nil
+}
+
+// Close прекращает прием сообщений. Повторный вызов ничего не делает
+func (c *Channel) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+// Acked возвращает копию подтвержденных сообщений
+func (c *Channel) Acked() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Message(nil), c.acked...)
+}
+
+// Nacked возвращает копию сообщений, отправленных на повтор
+func (c *Channel) Nacked() []Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Message(nil), c.nacked...)
+}
@@ -0,0 +1,301 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Подкаталоги входящего каталога: файлы в обработке и полностью обработанные
+const (
+	dirProcessing = ".processing"
+	dirDone       = ".done"
+)
+
+// Dir читает NDJSON файлы, которые кладут во входящий каталог: одна строка — одно сообщение.
+// Файл забирается переименованием в .processing, поэтому писать его нужно во временное имя
+// и переименовывать в *.ndjson после записи. Когда все строки подтверждены, файл переносится
+// в .done, а если какие-то получили Nack — обратно во входящий каталог и читается заново.
+// Уже сохраненные заказы при повторе пропускаются как дубликаты. Файлы не перезаписываются:
+// при совпадении имени в .done или входящем каталоге к имени добавляется номер
+type Dir struct {
+	dir      string
+	interval time.Duration
+
+	cur    *dirFile
+	reader *bufio.Reader
+
+	mu    sync.Mutex
+	files map[string]*dirFile
+}
+
+// dirFile учитывает выданные и подтвержденные строки забранного файла. source отличает
+// файлы с одинаковым именем, положенные в разное время: это имя и время изменения файла
+type dirFile struct {
+	name     string
+	source   string
+	modTime  time.Time
+	f        *os.File
+	line     int64
+	read     int64
+	acked    int64
+	nacked   int64
+	finished bool
+}
+
+// NewDir создает источник для каталога dir, который проверяется раз в interval.
+// Файлы, оставшиеся в .processing после аварийной остановки, возвращаются во входящий каталог
+func NewDir(dir string, interval time.Duration) (*Dir, error) {
+	for _, sub := range []string{dirProcessing, dirDone} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to prepare inbox: %w", err)
+		}
+	}
+
+	stale, err := os.ReadDir(filepath.Join(dir, dirProcessing))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inbox: %w", err)
+	}
+	for _, e := range stale {
+		if err := moveNoReplace(filepath.Join(dir, dirProcessing, e.Name()), dir, e.Name()); err != nil {
+			return nil, fmt.Errorf("failed to recover %s: %w", e.Name(), err)
+		}
+	}
+
+	return &Dir{
+		dir:      dir,
+		interval: interval,
+		files:    make(map[string]*dirFile),
+	}, nil
+}
+
+// Fetch возвращает следующую непустую строку, при необходимости забирая новый файл
+func (d *Dir) Fetch(ctx context.Context) (Message, error) {
+	for {
+		if d.cur == nil {
+			if err := d.claim(ctx); err != nil {
+				return Message{}, err
+			}
+		}
+
+		line, err := d.reader.ReadBytes('\n')
+		if len(line) > 0 {
+			d.cur.line++
+			if value := bytes.TrimSpace(line); len(value) > 0 {
+				return d.emit(value), nil
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return Message{}, fmt.Errorf("failed to read %s: %w", d.cur.name, err)
+		}
+
+		if err := d.eof(); err != nil {
+			return Message{}, err
+		}
+	}
+}
+
+func (d *Dir) emit(value []byte) Message {
+	d.mu.Lock()
+	d.cur.read++
+	d.mu.Unlock()
+
+	return Message{
+		Origin: OriginDir,
+		Source: d.cur.source,
+		Offset: d.cur.line,
+		Value:  bytes.Clone(value),
+		Time:   d.cur.modTime,
+	}
+}
+
+// eof закрывает дочитанный файл. Если все строки уже подтверждены, файл сразу переносится
+func (d *Dir) eof() error {
+	file := d.cur
+	d.cur, d.reader = nil, nil
+
+	if err := file.f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", file.name, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	file.finished = true
+
+	return d.finish(file)
+}
+
+// claim ждет новый файл и забирает его в обработку
+func (d *Dir) claim(ctx context.Context) error {
+	for {
+		name, err := d.next()
+		if err != nil {
+			return err
+		}
+
+		if name != "" {
+			// Файл с тем же именем может еще ждать подтверждений в .processing, его нельзя затереть
+			path := filepath.Join(d.dir, dirProcessing, name)
+			if err := os.Link(filepath.Join(d.dir, name), path); err != nil {
+				return fmt.Errorf("failed to claim %s: %w", name, err)
+			}
+			if err := os.Remove(filepath.Join(d.dir, name)); err != nil {
+				return fmt.Errorf("failed to claim %s: %w", name, err)
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", name, err)
+			}
+			info, err := f.Stat()
+			if err != nil {
+				_ = f.Close()
+				return fmt.Errorf("failed to stat %s: %w", name, err)
+			}
+
+			d.cur = &dirFile{
+				name:    name,
+				source:  name + "@" + info.ModTime().UTC().Format(time.RFC3339Nano),
+				modTime: info.ModTime(),
+				f:       f,
+			}
+			d.reader = bufio.NewReader(f)
+
+			d.mu.Lock()
+			d.files[d.cur.source] = d.cur
+			d.mu.Unlock()
+
+			return nil
+		}
+
+		timer := time.NewTimer(d.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// next возвращает самый старый по имени *.ndjson файл входящего каталога или "".
+// Файлы, одноименные еще не завершенным, ждут их переноса из .processing
+func (d *Dir) next() (string, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read inbox: %w", err)
+	}
+
+	d.mu.Lock()
+	busy := make(map[string]bool, len(d.files))
+	for _, file := range d.files {
+		busy[file.name] = true
+	}
+	d.mu.Unlock()
+
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), ".ndjson") && !busy[e.Name()] {
+			names = append(names, e.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Strings(names)
+
+	return names[0], nil
+}
+
+func (d *Dir) Ack(_ context.Context, msg Message) error {
+	return d.settle(msg, false)
+}
+
+func (d *Dir) Nack(_ context.Context, msg Message) error {
+	return d.settle(msg, true)
+}
+
+func (d *Dir) settle(msg Message, nack bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	file, ok := d.files[msg.Source]
+	if !ok {
+		return fmt.Errorf("unknown inbox file %s", msg.Source)
+	}
+
+	if nack {
+		file.nacked++
+	} else {
+		file.acked++
+	}
+
+	return d.finish(file)
+}
+
+// finish переносит дочитанный файл, когда подтверждены все его строки. Вызывается под d.mu
+func (d *Dir) finish(file *dirFile) error {
+	if !file.finished || file.acked+file.nacked < file.read {
+		return nil
+	}
+	delete(d.files, file.source)
+
+	target := filepath.Join(d.dir, dirDone)
+	if file.nacked > 0 {
+		target = d.dir
+	}
+	if err := moveNoReplace(filepath.Join(d.dir, dirProcessing, file.name), target, file.name); err != nil {
+		return fmt.Errorf("failed to move %s: %w", file.name, err)
+	}
+
+	return nil
+}
+
+// moveNoReplace переносит файл src в каталог dir под именем name, а если оно занято,
+// под name с номером: orders.1.ndjson, orders.2.ndjson. Жесткая ссылка, в отличие
+// от os.Rename, не затирает существующий файл
+func moveNoReplace(src, dir, name string) error {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	for i := 0; ; i++ {
+		target := name
+		if i > 0 {
+			target = fmt.Sprintf("%s.%d%s", base, i, ext)
+		}
+
+		err := os.Link(src, filepath.Join(dir, target))
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		return os.Remove(src)
+	}
+}
+
+// Close закрывает текущий файл. Незавершенные файлы остаются в .processing
+// и вернутся во входящий каталог при следующем запуске
+func (d *Dir) Close() error {
+	if d.cur != nil {
+		return d.cur.f.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,161 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// drop кладет файл во входящий каталог так, как требует Dir: через временное имя
+func drop(t *testing.T, dir, name, content string, mtime time.Time) {
+	t.Helper()
+
+	tmp := filepath.Join(dir, name+".tmp")
+	if err := os.WriteFile(tmp, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tmp, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// consume читает все строки одного файла и подтверждает их
+func consume(t *testing.T, d *Dir, lines int) []Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	msgs := make([]Message, lines)
+	for i := range msgs {
+		msg, err := d.Fetch(ctx)
+		if err != nil {
+			t.Fatalf("Fetch: %v", err)
+		}
+		msgs[i] = msg
+	}
+	for _, msg := range msgs {
+		if err := d.Ack(ctx, msg); err != nil {
+			t.Fatalf("Ack: %v", err)
+		}
+	}
+
+	return msgs
+}
+
+func names(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+
+	return names
+}
+
+func TestDirSameNameKeepsDoneFiles(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDir(dir, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	first := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	drop(t, dir, "orders.ndjson", "{\"n\": 1}\n{\"n\": 2}\n", first)
+	a := consume(t, d, 2)
+
+	// Выгрузка с тем же именем приходит позже: она не затирает первую в .done
+	drop(t, dir, "orders.ndjson", "{\"n\": 3}\n", first.Add(time.Hour))
+	b := consume(t, d, 1)
+	drop(t, dir, "orders.ndjson", "{\"n\": 4}\n", first.Add(2*time.Hour))
+	c := consume(t, d, 1)
+
+	// Перенос в .done происходит в Fetch после конца файла, ждем его
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := d.Fetch(ctx); err == nil {
+		t.Fatal("Fetch returned a message from an empty inbox")
+	}
+
+	done := names(t, filepath.Join(dir, dirDone))
+	if want := []string{"orders.1.ndjson", "orders.2.ndjson", "orders.ndjson"}; !slices.Equal(done, want) {
+		t.Fatalf(".done = %v, want %v", done, want)
+	}
+	contents := map[string]bool{}
+	for _, name := range done {
+		data, err := os.ReadFile(filepath.Join(dir, dirDone, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[string(data)] = true
+	}
+	if len(contents) != 3 {
+		t.Errorf(".done files are not distinct: %v", contents)
+	}
+
+	// Сообщения разных выгрузок различаются источником, иначе карантин их склеит
+	if a[0].Source == b[0].Source || b[0].Source == c[0].Source {
+		t.Errorf("sources of different claims collide: %s, %s, %s", a[0].Source, b[0].Source, c[0].Source)
+	}
+	if a[0].Source != a[1].Source || a[0].Source != "orders.ndjson@2024-01-02T15:04:05Z" {
+		t.Errorf("source = %s and %s, want orders.ndjson@2024-01-02T15:04:05Z", a[0].Source, a[1].Source)
+	}
+	if a[0].Origin != OriginDir {
+		t.Errorf("origin = %q, want %q", a[0].Origin, OriginDir)
+	}
+}
+
+func TestDirWaitsForSameNameInProcessing(t *testing.T) {
+	dir := t.TempDir()
+	d, err := NewDir(dir, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	drop(t, dir, "orders.ndjson", "{\"n\": 1}\n", first)
+	msg, err := d.Fetch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Строка первой выгрузки еще не подтверждена, вторая с тем же именем ждет во входящем
+	drop(t, dir, "orders.ndjson", "{\"n\": 2}\n", first.Add(time.Hour))
+	short, cancelShort := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancelShort()
+	if _, err := d.Fetch(short); err == nil {
+		t.Fatal("claimed a file while the same name is still in .processing")
+	}
+	if got := names(t, dir); !slices.Equal(got, []string{"orders.ndjson"}) {
+		t.Fatalf("inbox = %v, want the second file to wait", got)
+	}
+
+	if err := d.Ack(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	next, err := d.Fetch(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(next.Value) != `{"n": 2}` {
+		t.Errorf("second file value = %s", next.Value)
+	}
+}
@@ -0,0 +1,113 @@
+package source
+
+import (
+	"L0/internal/config"
+	"L0/internal/kafka/headers"
+	"context"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka читает топик консюмер группой. Смещение коммитится, только когда подтверждены
+// все предыдущие сообщения партиции, поэтому после рестарта последние сообщения могут
+// прийти повторно. Nack не коммитит смещение: сообщение придет снова после рестарта
+// или ребалансировки, kafka-go не умеет перематывать партицию внутри группы
+type Kafka struct {
+	reader  *kafka.Reader
+	topic   string
+	tracker *commitTracker
+}
+
+// NewKafka создает источник для топика из настроек чтения конфига
+func NewKafka(cfg config.Kafka, dialer *kafka.Dialer, topic string) *Kafka {
+	return &Kafka{
+		reader:  kafka.NewReader(readerConfig(cfg, dialer, topic)),
+		topic:   topic,
+		tracker: newCommitTracker(),
+	}
+}
+
+// readerConfig переносит настройки чтения из конфига. Конфиг уже проверен при загрузке,
+// так что kafka.NewReader не паникует на недопустимых значениях
+func readerConfig(cfg config.Kafka, dialer *kafka.Dialer, topic string) kafka.ReaderConfig {
+	// Стартовая позиция применяется только к партициям, для которых у группы нет коммита
+	startOffset := kafka.FirstOffset
+	if cfg.AutoOffsetReset == "latest" {
+		startOffset = kafka.LastOffset
+	}
+
+	isolation := kafka.ReadUncommitted
+	if cfg.Reader.IsolationLevel == "read_committed" {
+		isolation = kafka.ReadCommitted
+	}
+
+	balancers := make([]kafka.GroupBalancer, 0, len(cfg.Reader.PartitionAssignment))
+	for _, a := range cfg.Reader.PartitionAssignment {
+		switch a {
+		case config.AssignRange:
+			balancers = append(balancers, kafka.RangeGroupBalancer{})
+		case config.AssignRoundRobin:
+			balancers = append(balancers, kafka.RoundRobinGroupBalancer{})
+		}
+	}
+
+	return kafka.ReaderConfig{
+		Brokers:           cfg.Brokers,
+		Topic:             topic,
+		GroupID:           cfg.GroupID,
+		Dialer:            dialer,
+		QueueCapacity:     cfg.MaxPollRecords,
+		MinBytes:          cfg.Reader.MinBytes,
+		MaxBytes:          cfg.Reader.MaxBytes,
+		MaxWait:           cfg.Reader.MaxWait,
+		CommitInterval:    cfg.Reader.CommitInterval,
+		SessionTimeout:    cfg.Reader.SessionTimeout,
+		HeartbeatInterval: cfg.Reader.HeartbeatInterval,
+		RebalanceTimeout:  cfg.Reader.RebalanceTimeout,
+		IsolationLevel:    isolation,
+		GroupBalancers:    balancers,
+		StartOffset:       startOffset,
+	}
+}
+
+// Fetch читает следующее сообщение. Отмена ctx не теряет сообщение: оно остается
+// в буфере ридера и вернется следующим вызовом
+func (k *Kafka) Fetch(ctx context.Context) (Message, error) {
+	msg, err := k.reader.FetchMessage(ctx)
+	if err != nil {
+		return Message{}, err
+	}
+
+	k.tracker.add(msg.Partition, msg.Offset)
+
+	return Message{
+		Origin:        OriginKafka,
+		Source:        msg.Topic,
+		Partition:     msg.Partition,
+		Offset:        msg.Offset,
+		HighWaterMark: msg.HighWaterMark,
+		Key:           msg.Key,
+		Value:         msg.Value,
+		Headers:       headers.Map(msg.Headers),
+		Time:          msg.Time,
+	}, nil
+}
+
+// Ack коммитит смещение, если все предыдущие сообщения партиции уже подтверждены
+func (k *Kafka) Ack(ctx context.Context, msg Message) error {
+	var err error
+	k.tracker.done(msg.Partition, msg.Offset, func(offset int64) {
+		err = k.reader.CommitMessages(ctx, kafka.Message{Topic: k.topic, Partition: msg.Partition, Offset: offset})
+	})
+
+	return err
+}
+
+// Nack оставляет смещение незакоммиченным, см. Kafka
+func (k *Kafka) Nack(context.Context, Message) error {
+	return nil
+}
+
+func (k *Kafka) Close() error {
+	return k.reader.Close()
+}
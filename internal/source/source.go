@@ -0,0 +1,41 @@
+package source
+
+import (
+	"context"
+	"time"
+)
+
+// Происхождение сообщения, см. Message.Origin
+const (
+	OriginKafka = "kafka"
+	OriginDir   = "dir"
+)
+
+// Message является сообщением из любого источника. Source, Partition и Offset вместе
+// однозначно задают сообщение внутри источника: для Kafka это топик, партиция и смещение,
+// для файлов имя файла и номер строки. Origin называет вид источника, пустой у сообщений,
+// опубликованных в Channel. Time для Kafka является временем записи в брокер, для файлов
+// временем изменения файла и может быть нулевым
+type Message struct {
+	Origin        string
+	Source        string
+	Partition     int
+	Offset        int64
+	HighWaterMark int64
+	Key           []byte
+	Value         []byte
+	Headers       map[string]string
+	Time          time.Time
+}
+
+// MessageSource поставляет сообщения в конвейер обработки. Fetch вызывается из одной
+// горутины, Ack и Nack из воркеров в любом порядке. Fetch возвращает io.EOF, когда
+// сообщений больше не будет
+type MessageSource interface {
+	Fetch(ctx context.Context) (Message, error)
+	// Ack подтверждает, что сообщение обработано или сознательно отброшено
+	Ack(ctx context.Context, msg Message) error
+	// Nack сообщает, что сообщение не обработано и должно прийти снова
+	Nack(ctx context.Context, msg Message) error
+	Close() error
+}
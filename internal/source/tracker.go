@@ -0,0 +1,59 @@
+package source
+
+import (
+	"sync"
+)
+
+// pending является выданным, но еще не закоммиченным сообщением партиции
+type pending struct {
+	offset int64
+	done   bool
+}
+
+// commitTracker не дает закоммитить смещение, пока не подтверждены все сообщения
+// партиции до него. Нужен, когда воркеры завершают сообщения не по порядку
+type commitTracker struct {
+	mu         sync.Mutex
+	partitions map[int][]*pending
+}
+
+func newCommitTracker() *commitTracker {
+	return &commitTracker{partitions: make(map[int][]*pending)}
+}
+
+// add регистрирует прочитанное сообщение. Вызывается в порядке чтения
+func (t *commitTracker) add(partition int, offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.partitions[partition] = append(t.partitions[partition], &pending{offset: offset})
+}
+
+// done отмечает сообщение подтвержденным и коммитит последнее смещение непрерывной
+// подтвержденной цепочки. commit вызывается под блокировкой, чтобы смещения не шли назад.
+// Неподтвержденное сообщение держит цепочку, пока источник не перечитает партицию
+func (t *commitTracker) done(partition int, offset int64, commit func(offset int64)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	queue := t.partitions[partition]
+	for _, p := range queue {
+		if p.offset == offset {
+			p.done = true
+			break
+		}
+	}
+
+	n := 0
+	for n < len(queue) && queue[n].done {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+
+	last := queue[n-1].offset
+	t.partitions[partition] = queue[n:]
+
+	commit(last)
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"L0/internal/lib/audit"
+	"L0/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	ErrEventExists   = errors.New("event already applied")
+)
+
+// ApplyEvent пишет событие в историю заказа и обновляет его статус. Событие старше
+// последнего примененного только попадает в историю, а отмененный заказ больше не меняет статус.
+// Возвращает статус заказа после применения
+func (s *Storage) ApplyEvent(ctx context.Context, event models.OrderEvent) (string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to start a transaction: %v", err)
+	}
+	defer rollback(tx)
+
+	var (
+		status    string
+		updatedAt sql.NullTime
+	)
+	err = tx.QueryRowContext(ctx, `
+			SELECT status, status_updated_at
+			FROM orders WHERE order_uid = $1
+			FOR UPDATE`, event.OrderUID).Scan(&status, &updatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrOrderNotFound
+		}
+		return "", fmt.Errorf("failed to lock order: %v", err)
+	}
+
+	info := audit.FromContext(ctx)
+	res, err := tx.ExecContext(ctx, `
+			INSERT INTO order_events (
+			        order_uid, event_type, status, payload, occurred_at, trace_id, source_system
+			) VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (order_uid, event_type, occurred_at) DO NOTHING`,
+		event.OrderUID, event.Type, event.Status, nullJSON(event.Payload), event.OccurredAt,
+		nullString(info.TraceID), nullString(info.SourceSystem),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to insert order event: %v", err)
+	}
+
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return "", fmt.Errorf("failed to check inserted event: %v", err)
+	}
+	if inserted == 0 {
+		return status, ErrEventExists
+	}
+
+	if status != models.StatusCancelled && (!updatedAt.Valid || !event.OccurredAt.Before(updatedAt.Time)) {
+		_, err = tx.ExecContext(ctx, `
+				UPDATE orders SET status = $2, status_updated_at = $3
+				WHERE order_uid = $1`,
+			event.OrderUID, event.Status, event.OccurredAt.In(time.UTC),
+		)
+		if err != nil {
+			return "", fmt.Errorf("failed to update order status: %v", err)
+		}
+		status = event.Status
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit order event: %v", err)
+	}
+
+	return status, nil
+}
+
+// nullJSON пишет пустое тело как NULL, иначе JSONB не примет пустую строку
+func nullJSON(b []byte) any {
+	if len(b) == 0 {
+		return nil
+	}
+
+	return string(b)
+}
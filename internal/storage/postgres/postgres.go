@@ -2,8 +2,13 @@ package postgres
 
 import (
 	"L0/internal/config"
+	"L0/internal/lib/audit"
+	"L0/internal/lib/money"
 	"L0/internal/models"
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 
@@ -14,10 +19,16 @@ type Storage struct {
 	db *sql.DB
 }
 
+var (
+	ErrOrderExists = errors.New("order already exists")
+)
+
 type OrderStorage interface {
-	SaveOrder(order models.Order) error
+	SaveOrder(ctx context.Context, order models.Order) error
+	SaveOrders(ctx context.Context, orders []models.Order) []error
 	GetOrder(orderUID string) (*models.Order, error)
 	GetAllOrders() ([]models.Order, error)
+	ApplyEvent(ctx context.Context, event models.OrderEvent) (string, error)
 }
 
 // InitDB создает подключение к бд
@@ -45,34 +56,103 @@ func InitDB(cfg *config.Config) (*Storage, error) {
 	return &Storage{db: db}, nil
 }
 
-// SaveOrder сохраняет заказ в БД
-func (s *Storage) SaveOrder(order models.Order) error {
-	tx, err := s.db.Begin()
+// SaveOrder сохраняет заказ в БД. Trace ID и источник берутся из audit.Info в контексте
+func (s *Storage) SaveOrder(ctx context.Context, order models.Order) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("failed to start a transaction: %v", err)
 	}
-	defer func(tx *sql.Tx) {
-		err := tx.Rollback()
-		if err != nil {
-			log.Printf("failed to rollback transaction: %v", err)
+	defer rollback(tx)
+
+	if err := insertOrder(ctx, tx, order); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SaveOrders сохраняет пачку заказов одной транзакцией. Каждый заказ пишется под своим
+// savepoint, поэтому ошибка в одном не отменяет остальные. Возвращает ошибку по каждому заказу
+func (s *Storage) SaveOrders(ctx context.Context, orders []models.Order) []error {
+	errs := make([]error, len(orders))
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
 		}
-	}(tx)
+		return errs
+	}
 
-	_, err = tx.Exec(`
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fail(fmt.Errorf("failed to start a transaction: %v", err))
+	}
+	defer rollback(tx)
+
+	for i, order := range orders {
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT save_order`); err != nil {
+			return fail(fmt.Errorf("failed to create savepoint: %v", err))
+		}
+
+		if errs[i] = insertOrder(ctx, tx, order); errs[i] != nil {
+			if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT save_order`); err != nil {
+				return fail(fmt.Errorf("failed to rollback to savepoint: %v", err))
+			}
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT save_order`); err != nil {
+			return fail(fmt.Errorf("failed to release savepoint: %v", err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fail(fmt.Errorf("failed to commit orders: %v", err))
+	}
+
+	return errs
+}
+
+func rollback(tx *sql.Tx) {
+	if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		log.Printf("failed to rollback transaction: %v", err)
+	}
+}
+
+// insertOrder пишет заказ со всеми связанными таблицами в рамках транзакции
+func insertOrder(ctx context.Context, tx *sql.Tx, order models.Order) error {
+	info := audit.FromContext(ctx)
+
+	warnings, err := warningsJSON(order.Warnings)
+	if err != nil {
+		return fmt.Errorf("failed to encode warnings: %v", err)
+	}
+
+	res, err := tx.ExecContext(ctx, `
 			INSERT INTO orders (
                     order_uid, track_number, entry, locale, internal_signature,
-		            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		            customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard,
+		            trace_id, source_system, status, warnings
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, COALESCE($14, 'created'), $15)
 			ON CONFLICT (order_uid) DO NOTHING`,
 		order.OrderUID, order.TrackNumber, order.Entry, order.Locale,
 		order.InternalSignature, order.CustomerID, order.DeliveryService,
 		order.Shardkey, order.SmID, order.DateCreated, order.OofShard,
+		nullString(info.TraceID), nullString(info.SourceSystem), nullString(order.Status), warnings,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert a new handler: %v", err)
 	}
 
-	_, err = tx.Exec(`
+	// Повторная доставка того же заказа не должна дублировать товары
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check inserted order: %v", err)
+	}
+	if inserted == 0 {
+		return ErrOrderExists
+	}
+
+	_, err = tx.ExecContext(ctx, `
 			INSERT INTO deliveries (
 			        order_uid, name, phone, zip, city, address, region, email
 			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
@@ -92,7 +172,15 @@ func (s *Storage) SaveOrder(order models.Order) error {
 		return fmt.Errorf("failed to insert a new delivery: %v", err)
 	}
 
-	_, err = tx.Exec(`
+	// Суммы хранятся в минорных единицах валюты, например в копейках
+	currency := money.CurrencyOf(order.Payment.Currency)
+	payment, err := money.MinorUnits(currency,
+		order.Payment.Amount, order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
+	if err != nil {
+		return fmt.Errorf("failed to insert a new payment: %v", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
 			INSERT INTO payments (
 			        order_uid, transaction, request_id, currency, provider,
 			        amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
@@ -109,48 +197,107 @@ func (s *Storage) SaveOrder(order models.Order) error {
 					goods_total = EXCLUDED.goods_total,
 					custom_fee = EXCLUDED.custom_fee`,
 		order.OrderUID, order.Payment.Transaction, order.Payment.RequestID,
-		order.Payment.Currency, order.Payment.Provider, order.Payment.Amount,
-		order.Payment.PaymentDT, order.Payment.Bank, order.Payment.DeliveryCost,
-		order.Payment.GoodsTotal, order.Payment.CustomFee,
+		order.Payment.Currency, order.Payment.Provider, payment[0],
+		order.Payment.PaymentDT, order.Payment.Bank, payment[1],
+		payment[2], payment[3],
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert a new payment: %v", err)
 	}
 
 	for _, item := range order.Items {
-		_, err = tx.Exec(`
+		prices, err := money.MinorUnits(currency, item.Price, item.TotalPrice)
+		if err != nil {
+			return fmt.Errorf("failed to insert a new item: %v", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
 				INSERT INTO items (
 						order_uid, chrt_id, track_number, price, rid,
-						name, sale, size, total_price, nm_id, brand, status)
-				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
-			order.OrderUID, item.ChrtID, item.TrackNumber, item.Price,
-			item.RID, item.Name, item.Sale, item.Size, item.TotalPrice,
-			item.NmID, item.Brand, item.Status,
+						name, sale, size, total_price, nm_id, brand, status, currency)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+			order.OrderUID, item.ChrtID, item.TrackNumber, prices[0],
+			item.RID, item.Name, item.Sale, item.Size, prices[1],
+			item.NmID, item.Brand, item.Status, order.Payment.Currency,
 		)
 		if err != nil {
 			return fmt.Errorf("failed to insert a new item: %v", err)
 		}
 	}
 
-	return tx.Commit()
+	return nil
+}
+
+// warningsJSON пишет пустой список предупреждений как NULL
+func warningsJSON(warnings []models.Warning) ([]byte, error) {
+	if len(warnings) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(warnings)
+}
+
+// scanWarnings разбирает колонку warnings, NULL дает nil
+func scanWarnings(data []byte, order *models.Order) error {
+	if data == nil {
+		return nil
+	}
+
+	return json.Unmarshal(data, &order.Warnings)
+}
+
+// nullString пишет пустую строку как NULL, чтобы не отличать "неизвестно" от пустого значения
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
 }
 
-// GetOrder получает заказ из БД
+// paymentMinor принимает суммы оплаты из БД в минорных единицах валюты
+type paymentMinor struct {
+	amount, deliveryCost, goodsTotal, customFee int64
+}
+
+// apply переводит суммы в валюту оплаты, поэтому вызывается после чтения p.Currency
+func (m paymentMinor) apply(p *models.Payment) error {
+	return money.FromMinorUnits(money.CurrencyOf(p.Currency),
+		[]int64{m.amount, m.deliveryCost, m.goodsTotal, m.customFee},
+		&p.Amount, &p.DeliveryCost, &p.GoodsTotal, &p.CustomFee)
+}
+
+// itemMinor принимает цены товара из БД в минорных единицах его валюты
+type itemMinor struct {
+	currency          string
+	price, totalPrice int64
+}
+
+func (m itemMinor) apply(i *models.Item) error {
+	return money.FromMinorUnits(money.CurrencyOf(m.currency),
+		[]int64{m.price, m.totalPrice}, &i.Price, &i.TotalPrice)
+}
+
+// GetOrder получает заказ из БД вместе с товарами в порядке их сохранения
 func (s *Storage) GetOrder(orderUID string) (*models.Order, error) {
-	var order models.Order
+	var (
+		order    models.Order
+		warnings []byte
+	)
 
 	err := s.db.QueryRow(`
 			SELECT 
 			    	order_uid, track_number, entry, locale, internal_signature,
-			    	customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard
+			    	customer_id, delivery_service, shardkey, sm_id, date_created, oof_shard, status, warnings
 			FROM orders WHERE order_uid = $1`, orderUID).Scan(
 		&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale,
 		&order.InternalSignature, &order.CustomerID, &order.DeliveryService,
-		&order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard,
+		&order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.Status, &warnings,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get handler: %v", err)
 	}
+	// date_created приходит в часовом поясе сессии
+	order.Normalize()
+	if err := scanWarnings(warnings, &order); err != nil {
+		return nil, fmt.Errorf("failed to get warnings: %v", err)
+	}
 
 	err = s.db.QueryRow(`
 			SELECT
@@ -164,25 +311,30 @@ func (s *Storage) GetOrder(orderUID string) (*models.Order, error) {
 		return nil, fmt.Errorf("failed to get delivery: %v", err)
 	}
 
+	var payment paymentMinor
 	err = s.db.QueryRow(`
 			SELECT
 			    	transaction, request_id, currency, provider, amount,
 			    	payment_dt, bank, delivery_cost, goods_total, custom_fee
 			FROM payments WHERE order_uid = $1`, orderUID).Scan(
 		&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency,
-		&order.Payment.Provider, &order.Payment.Amount, &order.Payment.PaymentDT,
-		&order.Payment.Bank, &order.Payment.DeliveryCost, &order.Payment.GoodsTotal,
-		&order.Payment.CustomFee,
+		&order.Payment.Provider, &payment.amount, &order.Payment.PaymentDT,
+		&order.Payment.Bank, &payment.deliveryCost, &payment.goodsTotal,
+		&payment.customFee,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get payments: %v", err)
 	}
+	if err := payment.apply(&order.Payment); err != nil {
+		return nil, fmt.Errorf("failed to get payments: %v", err)
+	}
 
 	rows, err := s.db.Query(`
 			SELECT
 			    	chrt_id, track_number, price, rid, name,
-			    	sale, size, total_price, nm_id, brand, status
-			FROM items WHERE order_uid = $1`, orderUID)
+			    	sale, size, total_price, nm_id, brand, status, COALESCE(currency, '')
+			FROM items WHERE order_uid = $1
+			ORDER BY id`, orderUID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get items: %v", err)
 	}
@@ -194,15 +346,25 @@ func (s *Storage) GetOrder(orderUID string) (*models.Order, error) {
 	}(rows)
 
 	for rows.Next() {
-		var item models.Item
+		var (
+			item  models.Item
+			minor itemMinor
+		)
 		err := rows.Scan(
-			&item.ChrtID, &item.TrackNumber, &item.Price, &item.RID,
-			&item.Name, &item.Sale, &item.Size, &item.TotalPrice,
-			&item.NmID, &item.Brand, &item.Status,
+			&item.ChrtID, &item.TrackNumber, &minor.price, &item.RID,
+			&item.Name, &item.Sale, &item.Size, &minor.totalPrice,
+			&item.NmID, &item.Brand, &item.Status, &minor.currency,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get item: %v", err)
 		}
+		if err := minor.apply(&item); err != nil {
+			return nil, fmt.Errorf("failed to get item: %v", err)
+		}
+		order.Items = append(order.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get items: %v", err)
 	}
 
 	return &order, nil
@@ -212,7 +374,7 @@ func (s *Storage) GetOrder(orderUID string) (*models.Order, error) {
 func (s *Storage) GetAllOrders() ([]models.Order, error) {
 	rows, err := s.db.Query(`SELECT order_uid FROM orders`)
 	if err != nil {
-		log.Printf("failed to get handler uid: %v", err)
+		return nil, fmt.Errorf("failed to get handler uid: %v", err)
 	}
 	defer func(rows *sql.Rows) {
 		err := rows.Close()
@@ -235,6 +397,9 @@ func (s *Storage) GetAllOrders() ([]models.Order, error) {
 		}
 		orders = append(orders, *order)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get handler uid: %v", err)
+	}
 
 	return orders, nil
 }
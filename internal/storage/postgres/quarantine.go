@@ -0,0 +1,228 @@
+package postgres
+
+import (
+	"L0/internal/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrQuarantinedNotFound = errors.New("quarantined message not found")
+
+// QuarantineFilter ограничивает выборку карантина. Пустые поля не фильтруют
+type QuarantineFilter struct {
+	Status     string
+	ErrorClass string
+	Topic      string
+	AfterID    int64
+	Limit      int
+}
+
+const quarantineColumns = `
+		id, topic, kafka_partition, kafka_offset, message_key, headers,
+		event_type, content_type, schema_version, payload, error_class, error_message,
+		seen_count, first_seen_at, last_seen_at, edited_at, resubmitted_at, status`
+
+// Quarantine сохраняет необработанное сообщение. Повторная ошибка на том же смещении,
+// например после перемотки группы, обновляет ошибку и счетчик, но не затирает правки поддержки
+func (s *Storage) Quarantine(ctx context.Context, m models.QuarantinedMessage) error {
+	hdrs, err := json.Marshal(m.Headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode headers: %v", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+			INSERT INTO quarantined_messages (
+			        topic, kafka_partition, kafka_offset, message_key, headers,
+			        event_type, content_type, schema_version, payload, error_class, error_message
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (topic, kafka_partition, kafka_offset) DO UPDATE SET
+			        error_class   = EXCLUDED.error_class,
+			        error_message = EXCLUDED.error_message,
+			        seen_count    = quarantined_messages.seen_count + 1,
+			        last_seen_at  = now()`,
+		m.Topic, m.Partition, m.Offset, nullBytes([]byte(m.Key)), string(hdrs),
+		m.EventType, m.ContentType, m.SchemaVersion, m.Payload, m.ErrorClass, m.ErrorMessage,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine message: %v", err)
+	}
+
+	return nil
+}
+
+// ListQuarantined возвращает сообщения карантина в порядке id, постранично через AfterID
+func (s *Storage) ListQuarantined(ctx context.Context, filter QuarantineFilter) ([]models.QuarantinedMessage, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+
+	where, args := filter.where()
+	args = append(args, limit)
+	rows, err := s.db.QueryContext(ctx, `
+			SELECT`+quarantineColumns+`
+			FROM quarantined_messages
+			`+where+`
+			ORDER BY id
+			LIMIT $`+fmt.Sprint(len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quarantined messages: %v", err)
+	}
+	defer rows.Close()
+
+	messages := make([]models.QuarantinedMessage, 0)
+	for rows.Next() {
+		m, err := scanQuarantined(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, *m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read quarantined messages: %v", err)
+	}
+
+	return messages, nil
+}
+
+// GetQuarantined возвращает сообщение карантина по id
+func (s *Storage) GetQuarantined(ctx context.Context, id int64) (*models.QuarantinedMessage, error) {
+	row := s.db.QueryRowContext(ctx, `
+			SELECT`+quarantineColumns+`
+			FROM quarantined_messages
+			WHERE id = $1`, id)
+
+	m, err := scanQuarantined(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrQuarantinedNotFound
+		}
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// UpdateQuarantinedPayload заменяет тело сообщения исправленным. Пустой contentType
+// оставляет прежний формат
+func (s *Storage) UpdateQuarantinedPayload(ctx context.Context, id int64, payload []byte, contentType string) error {
+	res, err := s.db.ExecContext(ctx, `
+			UPDATE quarantined_messages
+			SET payload = $2, content_type = COALESCE($3, content_type), edited_at = now()
+			WHERE id = $1`,
+		id, payload, nullString(contentType),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update quarantined message: %v", err)
+	}
+
+	return checkQuarantinedAffected(res)
+}
+
+// MarkResubmitted помечает сообщение как успешно отправленное повторно
+func (s *Storage) MarkResubmitted(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `
+			UPDATE quarantined_messages
+			SET status = $2, resubmitted_at = now()
+			WHERE id = $1`,
+		id, models.QuarantineStatusResubmitted,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark quarantined message: %v", err)
+	}
+
+	return checkQuarantinedAffected(res)
+}
+
+func checkQuarantinedAffected(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check updated message: %v", err)
+	}
+	if affected == 0 {
+		return ErrQuarantinedNotFound
+	}
+
+	return nil
+}
+
+func (f QuarantineFilter) where() (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.Status != "" {
+		add("status = $%d", f.Status)
+	}
+	if f.ErrorClass != "" {
+		add("error_class = $%d", f.ErrorClass)
+	}
+	if f.Topic != "" {
+		add("topic = $%d", f.Topic)
+	}
+	if f.AfterID > 0 {
+		add("id > $%d", f.AfterID)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanQuarantined(row rowScanner) (*models.QuarantinedMessage, error) {
+	var (
+		m             models.QuarantinedMessage
+		key, hdrs     []byte
+		editedAt      sql.NullTime
+		resubmittedAt sql.NullTime
+	)
+
+	err := row.Scan(
+		&m.ID, &m.Topic, &m.Partition, &m.Offset, &key, &hdrs,
+		&m.EventType, &m.ContentType, &m.SchemaVersion, &m.Payload, &m.ErrorClass, &m.ErrorMessage,
+		&m.SeenCount, &m.FirstSeenAt, &m.LastSeenAt, &editedAt, &resubmittedAt, &m.Status,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan quarantined message: %v", err)
+	}
+
+	m.Key = string(key)
+	if err := json.Unmarshal(hdrs, &m.Headers); err != nil {
+		return nil, fmt.Errorf("failed to decode headers of message %d: %v", m.ID, err)
+	}
+	if editedAt.Valid {
+		m.EditedAt = &editedAt.Time
+	}
+	if resubmittedAt.Valid {
+		m.ResubmittedAt = &resubmittedAt.Time
+	}
+
+	return &m, nil
+}
+
+// nullBytes пишет пустой ключ сообщения как NULL
+func nullBytes(b []byte) any {
+	if len(b) == 0 {
+		return nil
+	}
+
+	return b
+}
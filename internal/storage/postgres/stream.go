@@ -0,0 +1,209 @@
+package postgres
+
+import (
+	"L0/internal/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// StreamFilter ограничивает выборку потоковой выгрузки. Пустые поля не фильтруют
+type StreamFilter struct {
+	AfterUID   string
+	From       time.Time
+	To         time.Time
+	CustomerID string
+	BatchSize  int
+}
+
+// StreamOrders читает заказы серверным курсором в порядке order_uid и передает их в fn.
+// В памяти одновременно держится не больше одной пачки, так что подходит для миллионов строк
+func (s *Storage) StreamOrders(ctx context.Context, filter StreamFilter, fn func(models.Order) error) error {
+	batchSize := filter.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to start a transaction: %v", err)
+	}
+	defer func(tx *sql.Tx) {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			log.Printf("failed to rollback transaction: %v", err)
+		}
+	}(tx)
+
+	where, args := filter.where()
+	_, err = tx.ExecContext(ctx, `
+			DECLARE orders_stream NO SCROLL CURSOR FOR
+			SELECT
+			    	o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature,
+			    	o.customer_id, o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.status, o.warnings,
+			    	d.name, d.phone, d.zip, d.city, d.address, d.region, d.email,
+			    	p.transaction, p.request_id, p.currency, p.provider, p.amount,
+			    	p.payment_dt, p.bank, p.delivery_cost, p.goods_total, p.custom_fee
+			FROM orders o
+			JOIN deliveries d ON d.order_uid = o.order_uid
+			JOIN payments p ON p.order_uid = o.order_uid
+			`+where+`
+			ORDER BY o.order_uid`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to declare cursor: %v", err)
+	}
+
+	for {
+		orders, err := fetchOrders(ctx, tx, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+
+		if err := attachItems(ctx, tx, orders); err != nil {
+			return err
+		}
+
+		for _, order := range orders {
+			if err := fn(order); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (f StreamFilter) where() (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.AfterUID != "" {
+		add("o.order_uid > $%d", f.AfterUID)
+	}
+	if !f.From.IsZero() {
+		add("o.date_created >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("o.date_created < $%d", f.To)
+	}
+	if f.CustomerID != "" {
+		add("o.customer_id = $%d", f.CustomerID)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+func fetchOrders(ctx context.Context, tx *sql.Tx, batchSize int) ([]models.Order, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("FETCH FORWARD %d FROM orders_stream", batchSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch orders: %v", err)
+	}
+	defer func(rows *sql.Rows) {
+		if err := rows.Close(); err != nil {
+			log.Printf("failed to close rows: %v", err)
+		}
+	}(rows)
+
+	orders := make([]models.Order, 0, batchSize)
+	for rows.Next() {
+		var (
+			order    models.Order
+			payment  paymentMinor
+			warnings []byte
+		)
+		err := rows.Scan(
+			&order.OrderUID, &order.TrackNumber, &order.Entry, &order.Locale,
+			&order.InternalSignature, &order.CustomerID, &order.DeliveryService,
+			&order.Shardkey, &order.SmID, &order.DateCreated, &order.OofShard, &order.Status, &warnings,
+			&order.Delivery.Name, &order.Delivery.Phone, &order.Delivery.Zip,
+			&order.Delivery.City, &order.Delivery.Address, &order.Delivery.Region,
+			&order.Delivery.Email,
+			&order.Payment.Transaction, &order.Payment.RequestID, &order.Payment.Currency,
+			&order.Payment.Provider, &payment.amount, &order.Payment.PaymentDT,
+			&order.Payment.Bank, &payment.deliveryCost, &payment.goodsTotal,
+			&payment.customFee,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan order: %v", err)
+		}
+		if err := payment.apply(&order.Payment); err != nil {
+			return nil, fmt.Errorf("failed to scan order payment: %v", err)
+		}
+		if err := scanWarnings(warnings, &order); err != nil {
+			return nil, fmt.Errorf("failed to scan order warnings: %v", err)
+		}
+		order.Normalize()
+		orders = append(orders, order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to fetch orders: %v", err)
+	}
+
+	return orders, nil
+}
+
+// attachItems догружает товары одной пачкой для всех заказов
+func attachItems(ctx context.Context, tx *sql.Tx, orders []models.Order) error {
+	uids := make([]string, len(orders))
+	index := make(map[string]int, len(orders))
+	for i, order := range orders {
+		uids[i] = order.OrderUID
+		index[order.OrderUID] = i
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+			SELECT
+			    	order_uid, chrt_id, track_number, price, rid, name,
+			    	sale, size, total_price, nm_id, brand, status, COALESCE(currency, '')
+			FROM items WHERE order_uid = ANY($1)
+			ORDER BY order_uid, id`, pq.Array(uids))
+	if err != nil {
+		return fmt.Errorf("failed to get items: %v", err)
+	}
+	defer func(rows *sql.Rows) {
+		if err := rows.Close(); err != nil {
+			log.Printf("failed to close rows: %v", err)
+		}
+	}(rows)
+
+	for rows.Next() {
+		var (
+			orderUID string
+			item     models.Item
+			minor    itemMinor
+		)
+		err := rows.Scan(
+			&orderUID, &item.ChrtID, &item.TrackNumber, &minor.price, &item.RID,
+			&item.Name, &item.Sale, &item.Size, &minor.totalPrice,
+			&item.NmID, &item.Brand, &item.Status, &minor.currency,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to get item: %v", err)
+		}
+		if err := minor.apply(&item); err != nil {
+			return fmt.Errorf("failed to get item: %v", err)
+		}
+
+		i := index[orderUID]
+		orders[i].Items = append(orders[i].Items, item)
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_orders_trace_id;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS ingested_at,
+    DROP COLUMN IF EXISTS source_system,
+    DROP COLUMN IF EXISTS trace_id;
\ No newline at end of file
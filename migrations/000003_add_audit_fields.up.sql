@@ -0,0 +1,6 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS trace_id      VARCHAR(64),
+    ADD COLUMN IF NOT EXISTS source_system VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS ingested_at   TIMESTAMP WITH TIME ZONE DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS idx_orders_trace_id ON orders(trace_id);
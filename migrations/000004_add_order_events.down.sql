@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS order_events;
+
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS status_updated_at,
+    DROP COLUMN IF EXISTS status;
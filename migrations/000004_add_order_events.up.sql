@@ -0,0 +1,18 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS status            VARCHAR(32) NOT NULL DEFAULT 'created',
+    ADD COLUMN IF NOT EXISTS status_updated_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS order_events (
+    id            BIGSERIAL PRIMARY KEY,
+    order_uid     VARCHAR(255) NOT NULL REFERENCES orders(order_uid),
+    event_type    VARCHAR(64)  NOT NULL,
+    status        VARCHAR(32)  NOT NULL,
+    payload       JSONB,
+    occurred_at   TIMESTAMP WITH TIME ZONE NOT NULL,
+    trace_id      VARCHAR(64),
+    source_system VARCHAR(255),
+    received_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    UNIQUE (order_uid, event_type, occurred_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_events_order_uid ON order_events(order_uid, occurred_at);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS quarantined_messages (
+    id              BIGSERIAL PRIMARY KEY,
+    topic           VARCHAR(255) NOT NULL,
+    kafka_partition INTEGER      NOT NULL,
+    kafka_offset    BIGINT       NOT NULL,
+    message_key     BYTEA,
+    headers         JSONB        NOT NULL DEFAULT '{}',
+    event_type      VARCHAR(64)  NOT NULL,
+    content_type    VARCHAR(255) NOT NULL,
+    schema_version  VARCHAR(16)  NOT NULL,
+    payload         BYTEA        NOT NULL,
+    error_class     VARCHAR(64)  NOT NULL,
+    error_message   TEXT         NOT NULL,
+    seen_count      INTEGER      NOT NULL DEFAULT 1,
+    first_seen_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    last_seen_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    edited_at       TIMESTAMP WITH TIME ZONE,
+    resubmitted_at  TIMESTAMP WITH TIME ZONE,
+    status          VARCHAR(16)  NOT NULL DEFAULT 'quarantined',
+    UNIQUE (topic, kafka_partition, kafka_offset)
+);
+
+CREATE INDEX IF NOT EXISTS idx_quarantined_messages_status ON quarantined_messages(status, id);
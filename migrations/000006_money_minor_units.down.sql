@@ -0,0 +1,24 @@
+-- Дробные суммы округляются до целых единиц валюты
+CREATE OR REPLACE FUNCTION minor_unit_factor(code TEXT) RETURNS BIGINT AS $$
+    SELECT CASE
+        WHEN code IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG',
+                      'RWF', 'UGX', 'UYI', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+        WHEN code IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000
+        WHEN code IN ('CLF', 'UYW') THEN 10000
+        ELSE 100
+    END
+$$ LANGUAGE SQL IMMUTABLE;
+
+ALTER TABLE items
+    ALTER COLUMN price       TYPE INTEGER USING round(price::NUMERIC / minor_unit_factor(currency)),
+    ALTER COLUMN total_price TYPE INTEGER USING round(total_price::NUMERIC / minor_unit_factor(currency));
+
+ALTER TABLE items DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE payments
+    ALTER COLUMN amount        TYPE INTEGER USING round(amount::NUMERIC / minor_unit_factor(currency)),
+    ALTER COLUMN delivery_cost TYPE INTEGER USING round(delivery_cost::NUMERIC / minor_unit_factor(currency)),
+    ALTER COLUMN goods_total   TYPE INTEGER USING round(goods_total::NUMERIC / minor_unit_factor(currency)),
+    ALTER COLUMN custom_fee    TYPE INTEGER USING round(custom_fee::NUMERIC / minor_unit_factor(currency));
+
+DROP FUNCTION minor_unit_factor(TEXT);
@@ -0,0 +1,29 @@
+-- Суммы переводятся из целых единиц валюты в минорные единицы ISO 4217.
+-- Неизвестные коды считаются валютами с двумя знаками, как и в приложении
+CREATE OR REPLACE FUNCTION minor_unit_factor(code TEXT) RETURNS BIGINT AS $$
+    SELECT CASE
+        WHEN code IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG',
+                      'RWF', 'UGX', 'UYI', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN 1
+        WHEN code IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN 1000
+        WHEN code IN ('CLF', 'UYW') THEN 10000
+        ELSE 100
+    END
+$$ LANGUAGE SQL IMMUTABLE;
+
+ALTER TABLE payments
+    ALTER COLUMN amount        TYPE BIGINT USING amount * minor_unit_factor(currency),
+    ALTER COLUMN delivery_cost TYPE BIGINT USING delivery_cost * minor_unit_factor(currency),
+    ALTER COLUMN goods_total   TYPE BIGINT USING goods_total * minor_unit_factor(currency),
+    ALTER COLUMN custom_fee    TYPE BIGINT USING custom_fee * minor_unit_factor(currency);
+
+-- Валюта товара совпадает с валютой оплаты, но хранится рядом с ценой,
+-- чтобы минорные единицы можно было прочитать без соединения с payments
+ALTER TABLE items ADD COLUMN IF NOT EXISTS currency VARCHAR(10);
+
+UPDATE items i SET currency = p.currency FROM payments p WHERE p.order_uid = i.order_uid;
+
+ALTER TABLE items
+    ALTER COLUMN price       TYPE BIGINT USING price * minor_unit_factor(currency),
+    ALTER COLUMN total_price TYPE BIGINT USING total_price * minor_unit_factor(currency);
+
+DROP FUNCTION minor_unit_factor(TEXT);
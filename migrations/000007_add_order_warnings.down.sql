@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_orders_has_warnings;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS warnings;
@@ -0,0 +1,4 @@
+-- Предупреждения проверки согласованности сумм, NULL у заказов без нарушений
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS warnings JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_orders_has_warnings ON orders(order_uid) WHERE warnings IS NOT NULL;
@@ -10,7 +10,11 @@ GRANT CONNECT ON DATABASE order_service TO order_admin;
 \c order_service
 GRANT USAGE ON SCHEMA public TO order_admin;
 GRANT CREATE ON SCHEMA public TO order_admin;
+-- UPDATE нужен для ON CONFLICT DO UPDATE в таблицах заказа, для SELECT FOR UPDATE
+-- и смены статуса в orders по событиям и для разбора карантина в quarantined_messages
 ALTER DEFAULT PRIVILEGES IN SCHEMA public
-    GRANT SELECT, INSERT ON TABLES TO order_admin;
+    GRANT SELECT, INSERT, UPDATE ON TABLES TO order_admin;
+-- Для базы, где таблицы уже созданы
+GRANT SELECT, INSERT, UPDATE ON ALL TABLES IN SCHEMA public TO order_admin;
 ALTER DEFAULT PRIVILEGES IN SCHEMA public
     GRANT ALL PRIVILEGES ON SEQUENCES TO order_admin;
\ No newline at end of file